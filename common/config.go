@@ -1,22 +1,176 @@
 package common
 
+import "time"
+
 type Config struct {
-	Http      Http       `yaml:"Http"`
-	Endpoints []Endpoint `yaml:"Endpoints"`
-	Log       Log        `yaml:"Log"`
-	Forbidden Forbidden  `yaml:"Forbidden"`
+	Http           Http       `yaml:"Http"`
+	Endpoints      []Endpoint `yaml:"Endpoints"`
+	Log            Log        `yaml:"Log"`
+	Forbidden      Forbidden  `yaml:"Forbidden"`
+	Replay         Replay     `yaml:"Replay"`
+	Quarantine     Quarantine `yaml:"Quarantine"`
+	Expiry         Expiry     `yaml:"Expiry"`
+	Upstream       Upstream   `yaml:"Upstream"`
+	Secrets        Secrets    `yaml:"Secrets"`
+	Metrics        Metrics    `yaml:"Metrics"`
+	Tracing        Tracing    `yaml:"Tracing"`
+	Audit          Audit      `yaml:"Audit"`
+	Export         Export     `yaml:"Export"`
+	Health         Health     `yaml:"Health"`
+	Admin          Admin      `yaml:"Admin"`
+	AllowedCIDRs   []string   `yaml:"AllowedCIDRs"`   // clients allowed to access the proxy, empty means any
+	TrustedProxies []string   `yaml:"TrustedProxies"` // proxies whose X-Forwarded-For is trusted
+}
+
+type Metrics struct {
+	Enabled *bool  `yaml:"Enabled"` // enabled by default
+	Path    string `yaml:"Path"`    // defaults to /metrics
+}
+
+// Tracing exports the spans of the proxied requests to an OpenTelemetry collector with OTLP/HTTP.
+type Tracing struct {
+	Enabled     bool              `yaml:"Enabled"`
+	Endpoint    string            `yaml:"Endpoint"`    // url of the collector, defaults to http://127.0.0.1:4318/v1/traces
+	Headers     map[string]string `yaml:"Headers"`     // headers sent to the collector, such as the auth token
+	ServiceName string            `yaml:"ServiceName"` // defaults to key-proxy
+	SampleRatio *float64          `yaml:"SampleRatio"` // ratio of the traces started by the proxy, defaults to 1
 }
 
 type Forbidden struct {
 	ForbiddenAccountNotFound    bool `yaml:"ForbiddenAccountNotFound"`
 	ForbiddenProxyCredentialErr bool `yaml:"ForbiddenProxyCredentialErr"`
+
+	// the modes below take precedence over the switches above
+	AccountNotFound    ForbiddenRule `yaml:"AccountNotFound"`
+	ProxyCredentialErr ForbiddenRule `yaml:"ProxyCredentialErr"`
+	Policy             ForbiddenRule `yaml:"Policy"`   // Policy and ReadOnly of the cloud accounts
+	ClientIP           ForbiddenRule `yaml:"ClientIP"` // AllowedCIDRs of the proxy and the cloud accounts
+}
+
+type ForbiddenRule struct {
+	Mode string `yaml:"Mode"` // enforce, shadow, off, or quarantine for AccountNotFound and ProxyCredentialErr
 }
 
+// Expiry configures the expiry of the proxy credentials and the reminders before they expire.
+type Expiry struct {
+	MaxAge         int    `yaml:"MaxAge"`         // days a proxy credential is valid since its CreatedAt, 0 means unlimited
+	WarnBefore     int    `yaml:"WarnBefore"`     // days before the expiry to start reminding, defaults to 14
+	CheckInterval  int    `yaml:"CheckInterval"`  // seconds, defaults to 3600
+	RemindInterval int    `yaml:"RemindInterval"` // seconds between the reminders of the same credential, defaults to 86400
+	Webhook        string `yaml:"Webhook"`        // url which the reminders are posted to as JSON
+}
+
+type Quarantine struct {
+	Dir          string `yaml:"Dir"`          // directory of the evidences of the quarantined requests
+	MaxBodySize  int    `yaml:"MaxBodySize"`  // bytes of the request body recorded
+	MaxEvidences int    `yaml:"MaxEvidences"` // max evidences kept in the directory, the oldest ones are removed when it is full
+}
+
+type Replay struct {
+	Enabled        bool `yaml:"Enabled"`
+	ClockSkew      int  `yaml:"ClockSkew"`      // seconds
+	NonceCacheSize int  `yaml:"NonceCacheSize"` // max nonces or signatures remembered
+}
+
+type Upstream struct {
+	AllowPrivateNetwork bool `yaml:"AllowPrivateNetwork"` // allow forwarding to loopback or private addresses
+}
+
+type Secrets struct {
+	RefreshInterval int   `yaml:"RefreshInterval"` // seconds, 0 disables refreshing
+	Vault           Vault `yaml:"Vault"`
+}
+
+type Vault struct {
+	Address   string `yaml:"Address"` // defaults to $VAULT_ADDR
+	Token     string `yaml:"Token"`   // defaults to $VAULT_TOKEN
+	TokenFile string `yaml:"TokenFile"`
+	Namespace string `yaml:"Namespace"`
+}
+
+// Audit writes a hash-chained record for each proxied request into a separate rotated file.
 type Audit struct {
-	Output  string `yaml:"Output"`
-	Enabled bool   `yaml:"Enabled"`
-	MaxAge  int    `yaml:"MaxAge"`
-	MaxSize int    `yaml:"MaxSize"`
+	Output         string `yaml:"Output"` // directory of the audit files, defaults to ./output/audit
+	Enabled        bool   `yaml:"Enabled"`
+	Key            string `yaml:"Key"`            // key of the HMAC chaining the records, may be a secret reference
+	MaxAge         int    `yaml:"MaxAge"`         // days to keep the rotated files, 0 keeps them forever
+	MaxSize        int    `yaml:"MaxSize"`        // megabytes of a file before it is rotated, defaults to 100
+	AnchorInterval int    `yaml:"AnchorInterval"` // seconds between the anchors of the last record, defaults to 60
+}
+
+// Health configures the probes served on the proxy port: /healthz, /readyz and /selftest.
+type Health struct {
+	CheckUpstream    bool `yaml:"CheckUpstream"`    // /readyz also resolves and connects to the upstream hosts of the vendors
+	UpstreamTimeout  int  `yaml:"UpstreamTimeout"`  // seconds, defaults to 3
+	UpstreamCacheTTL int  `yaml:"UpstreamCacheTTL"` // seconds to reuse the results of checking the upstream hosts, defaults to 30
+	SelfTestCacheTTL int  `yaml:"SelfTestCacheTTL"` // seconds to reuse the results of the self test, defaults to 30
+}
+
+// Admin serves the admin API on a separate listener. The clients are authenticated with the token, the client
+// certificates, or both if both are configured.
+type Admin struct {
+	Enabled    bool   `yaml:"Enabled"`
+	Address    string `yaml:"Address"`    // defaults to 127.0.0.1:3889
+	Token      string `yaml:"Token"`      // sent as "Authorization: Bearer <Token>", may be a secret reference
+	Tls        Tls    `yaml:"Tls"`        // Address and ClientAuth.Bindings are ignored, ClientAuth.Mode require enables mTLS
+	MaxBlocked int    `yaml:"MaxBlocked"` // recent blocked requests kept in memory, defaults to 100
+}
+
+// Export ships the traffic and audit events to external systems. Each sink has a bounded buffer, retries the failed
+// deliveries and spools the undelivered events to the disk, so a slow sink never blocks the requests.
+type Export struct {
+	Events       []string      `yaml:"Events"`       // request, response, audit and anchor, defaults to all
+	BufferSize   int           `yaml:"BufferSize"`   // events buffered in memory per sink, defaults to 10000
+	MaxRetries   int           `yaml:"MaxRetries"`   // retries before the events are spooled, defaults to 3
+	SpoolDir     string        `yaml:"SpoolDir"`     // defaults to ./output/spool
+	SpoolMaxSize int           `yaml:"SpoolMaxSize"` // megabytes spooled per sink, events beyond are dropped, defaults to 100
+	Syslog       []SyslogSink  `yaml:"Syslog"`
+	Webhook      []WebhookSink `yaml:"Webhook"`
+	Kafka        []KafkaSink   `yaml:"Kafka"`
+}
+
+// SyslogSink sends the events as RFC 5424 messages, framed by octet counting over tcp and tls.
+type SyslogSink struct {
+	Name     string    `yaml:"Name"`     // names the spool directory and the metrics, defaults to syslog-<index>
+	Network  string    `yaml:"Network"`  // udp, tcp or tls
+	Address  string    `yaml:"Address"`  // host:port
+	Facility int       `yaml:"Facility"` // defaults to 16 (local0)
+	AppName  string    `yaml:"AppName"`  // defaults to key-proxy
+	Tls      ClientTls `yaml:"Tls"`
+}
+
+// WebhookSink posts the events in JSON arrays, signed with HMAC-SHA256 if Secret is set.
+type WebhookSink struct {
+	Name    string            `yaml:"Name"` // defaults to webhook-<index>
+	Url     string            `yaml:"Url"`
+	Secret  string            `yaml:"Secret"`
+	Headers map[string]string `yaml:"Headers"`
+	Timeout int               `yaml:"Timeout"` // seconds, defaults to 10
+}
+
+// KafkaSink produces the events to the topic.
+type KafkaSink struct {
+	Name    string    `yaml:"Name"` // defaults to kafka-<index>
+	Brokers []string  `yaml:"Brokers"`
+	Topic   string    `yaml:"Topic"`
+	Tls     ClientTls `yaml:"Tls"`
+	Sasl    Sasl      `yaml:"Sasl"`
+}
+
+type Sasl struct {
+	Mechanism string `yaml:"Mechanism"` // PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, empty disables SASL
+	Username  string `yaml:"Username"`
+	Password  string `yaml:"Password"`
+}
+
+// ClientTls configures the connections to the servers of the sinks.
+type ClientTls struct {
+	Enabled            bool   `yaml:"Enabled"` // always enabled for the tls network of syslog
+	CaFile             string `yaml:"CaFile"`  // defaults to the system roots
+	CertFile           string `yaml:"CertFile"`
+	KeyFile            string `yaml:"KeyFile"`
+	ServerName         string `yaml:"ServerName"`
+	InsecureSkipVerify bool   `yaml:"InsecureSkipVerify"`
 }
 
 type Log struct {
@@ -24,29 +178,101 @@ type Log struct {
 	Level   string `yaml:"Level"`
 	MaxAge  int    `yaml:"MaxAge"`
 	MaxSize int    `yaml:"MaxSize"`
+	Format  string `yaml:"Format"` // console or json, defaults to console
 }
 
 type Http struct {
-	Address string `yaml:"Address"`
-	Tls     Tls    `yaml:"Tls"`
+	Address         string `yaml:"Address"`
+	Enabled         *bool  `yaml:"Enabled"` // plain http is enabled by default unless Tls is enabled
+	Tls             Tls    `yaml:"Tls"`
+	Unix            Unix   `yaml:"Unix"`
+	ShutdownTimeout int    `yaml:"ShutdownTimeout"` // seconds to drain in-flight requests while shutting down
+}
+
+type Unix struct {
+	Enabled bool   `yaml:"Enabled"`
+	Path    string `yaml:"Path"`
+	Mode    string `yaml:"Mode"` // file mode of the socket in octal, defaults to "0660"
 }
 
 type Tls struct {
-	Address  string `yaml:"Address"`
-	Enabled  bool   `yaml:"Enabled"`
+	Address        string        `yaml:"Address"`
+	Enabled        bool          `yaml:"Enabled"`
+	CertFile       string        `yaml:"CertFile"`
+	KeyFile        string        `yaml:"KeyFile"`
+	Certificates   []Certificate `yaml:"Certificates"`   // additional certificates selected by SNI
+	MinVersion     string        `yaml:"MinVersion"`     // 1.0, 1.1, 1.2 or 1.3, defaults to 1.2
+	CipherSuites   []string      `yaml:"CipherSuites"`   // e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, only for TLS 1.2 and below
+	ReloadInterval int           `yaml:"ReloadInterval"` // seconds to check the certificate files for changes
+	ClientAuth     ClientAuth    `yaml:"ClientAuth"`
+}
+
+type Certificate struct {
 	CertFile string `yaml:"CertFile"`
 	KeyFile  string `yaml:"KeyFile"`
 }
 
+type ClientAuth struct {
+	Mode     string          `yaml:"Mode"`   // none, optional or require
+	CAFile   string          `yaml:"CAFile"` // CA bundle to verify client certificates
+	Bindings []ClientBinding `yaml:"Bindings"`
+}
+
+// ClientBinding restricts the cloud accounts which a client certificate is allowed to access.
+type ClientBinding struct {
+	Subject           string   `yaml:"Subject"` // common name, DNS, URI or email SAN of the certificate
+	CloudAccountNames []string `yaml:"CloudAccountNames"`
+	TopAccountIds     []string `yaml:"TopAccountIds"`
+}
+
 type Endpoint struct {
 	CloudAccountName string      `yaml:"CloudAccountName"`
 	Vendor           string      `yaml:"Vendor"`
 	Credentials      Credentials `yaml:"Credentials"`
+	AllowedHosts     []string    `yaml:"AllowedHosts"` // overrides the default host patterns of the vendor
+	AllowedCIDRs     []string    `yaml:"AllowedCIDRs"` // clients allowed to use the cloud account, empty means any
+	Policy           Policy      `yaml:"Policy"`
+	ReadOnly         bool        `yaml:"ReadOnly"` // only allow operations which do not change resources
+}
+
+// Policy lists the operations allowed or denied, patterns are like "cdn:DescribeCdnDomain" or "cdn:Delete*".
+// Deny takes precedence over Allow, and all operations are allowed if Allow is empty.
+type Policy struct {
+	Allow []string `yaml:"Allow"`
+	Deny  []string `yaml:"Deny"`
 }
 
 type Credentials struct {
-	Proxy Credential `yaml:"Proxy"`
-	Real  Credential `yaml:"Real"`
+	Proxy         Credential        `yaml:"Proxy"`
+	ProxyValidity Validity          `yaml:"ProxyValidity"` // validity of Proxy, like that of each one in Proxies
+	Proxies       []ProxyCredential `yaml:"Proxies"`       // accepted besides Proxy, to rotate the proxy credential without downtime
+	Real          Credential        `yaml:"Real"`
+	AssumeRole    AssumeRole        `yaml:"AssumeRole"` // signs with the temporary credential of the role assumed with Real
+}
+
+// AssumeRole is the role assumed with the real credential, supported by aws, volcengine, aliyun and tencent.
+type AssumeRole struct {
+	RoleArn       string `yaml:"RoleArn"` // arn of aws, aliyun and tencent, or trn of volcengine
+	SessionName   string `yaml:"SessionName"`
+	ExternalId    string `yaml:"ExternalId"`
+	Duration      int    `yaml:"Duration"`      // seconds, defaults to 3600
+	RefreshBefore int    `yaml:"RefreshBefore"` // seconds before the expiry to refresh the credential, defaults to 300
+	Region        string `yaml:"Region"`        // region of the STS service
+	Endpoint      string `yaml:"Endpoint"`      // url of the STS service, defaults to the public endpoint of the vendor
+}
+
+// ProxyCredential is a proxy credential accepted during its validity period, zero times mean unlimited.
+type ProxyCredential struct {
+	Credential `yaml:",inline"`
+	Name       string `yaml:"Name"` // reported as the matched proxy credential, defaults to the access key
+	Validity   `yaml:",inline"`
+}
+
+// Validity is the period in which a proxy credential is accepted.
+type Validity struct {
+	NotBefore time.Time `yaml:"NotBefore"`
+	NotAfter  time.Time `yaml:"NotAfter"`
+	CreatedAt time.Time `yaml:"CreatedAt"` // the credential expires after Expiry.MaxAge days since it is created
 }
 
 type Credential struct {
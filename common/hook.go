@@ -7,7 +7,7 @@ import (
 )
 
 type BaseInfo struct {
-	Request          *http.Request
+	Request          *http.Request `json:"-"`
 	RequestTime      time.Time
 	CloudAccountId   string
 	CloudAccountName string
@@ -17,14 +17,17 @@ type BaseInfo struct {
 	RequestId        string
 	TargetUrl        string
 	ProxyVersion     string
+	ClientIP         string
 }
 
 type OnRequest func(ctx context.Context, requestInfo RequestInfo)
 type OnResponse func(ctx context.Context, response ResponseInfo)
+type OnShutdown func(ctx context.Context) error
 
 type RequestInfo struct {
 	BaseInfo
-	RequestTime time.Time
+	RequestTime     time.Time
+	ProxyCredential string // name of the matched proxy credential, only known by the OnReformedRequest hook
 }
 
 type ResponseInfo struct {
@@ -34,4 +37,6 @@ type ResponseInfo struct {
 	HttpStatus             int
 	ProxyException         bool
 	ProxyExceptionTextCode string
+	ShadowViolations       []string // codes of the exceptions not raised because their rules are in shadow mode
+	ProxyCredential        string   // name of the matched proxy credential
 }
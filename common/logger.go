@@ -9,3 +9,29 @@ type Logger interface {
 	CtxError(ctx context.Context, template string, args ...interface{})
 	CtxFatal(ctx context.Context, template string, args ...interface{})
 }
+
+// LogField is a request-scoped field, such as the request id, attached to the logs emitted while handling the request.
+type LogField struct {
+	Key   string
+	Value string
+}
+
+type logFieldsKey struct{}
+
+// WithLogFields returns a context carrying the fields in addition to the fields already in the context.
+func WithLogFields(ctx context.Context, fields ...LogField) context.Context {
+	current := LogFields(ctx)
+	merged := make([]LogField, 0, len(current)+len(fields))
+	merged = append(merged, current...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, logFieldsKey{}, merged)
+}
+
+// LogFields returns the request-scoped fields of the context, custom loggers may attach them to their logs.
+func LogFields(ctx context.Context) []LogField {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(logFieldsKey{}).([]LogField)
+	return fields
+}
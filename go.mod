@@ -5,9 +5,15 @@ go 1.16
 require (
 	github.com/aws/aws-sdk-go v1.44.229
 	github.com/gin-gonic/gin v1.9.0
+	github.com/prometheus/client_golang v1.12.2
+	github.com/segmentio/kafka-go v0.4.42
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
 	go.uber.org/zap v1.24.0
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
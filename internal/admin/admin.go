@@ -0,0 +1,206 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/volcengine/key-proxy/internal/handler"
+	"github.com/volcengine/key-proxy/internal/service"
+	"github.com/volcengine/key-proxy/internal/service/provider"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const defaultBlockedLimit = 20
+
+// Handler serves the admin API. The clients are authenticated by the token if it is not empty, the client
+// certificates are verified by the listener.
+type Handler struct {
+	recorder *Recorder
+	token    string
+	reload   func() error
+}
+
+// NewHandler creates the admin API. reload reloads the config of the proxy, readiness is shared with the probes of
+// the proxy port.
+func NewHandler(recorder *Recorder, token string, reload func() error, readiness *handler.Readiness) http.Handler {
+	h := &Handler{
+		recorder: recorder,
+		token:    token,
+		reload:   reload,
+	}
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(h.authenticate)
+	r.GET("/accounts", h.listAccounts)
+	r.POST("/accounts/:name/disable", h.disableAccount)
+	r.POST("/accounts/:name/enable", h.enableAccount)
+	r.GET("/stats", h.stats)
+	r.GET("/blocked", h.blocked)
+	r.POST("/reload", h.reloadConfig)
+	r.GET("/log-level", h.logLevel)
+	r.PUT("/log-level", h.setLogLevel)
+	r.GET("/selftest", h.selfTest)
+	r.GET("/readyz", readiness.ReadyzDetails)
+	return r
+}
+
+func writeError(c *gin.Context, status int, err error) {
+	c.AbortWithStatusJSON(status, gin.H{"Error": err.Error()})
+}
+
+func (h *Handler) authenticate(c *gin.Context) {
+	if h.token == "" {
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		logs.CtxWarn(c.Request.Context(), "[Admin] unauthorized request from %s: %s %s", c.ClientIP(), c.Request.Method, c.Request.URL.Path)
+		c.Header("WWW-Authenticate", "Bearer")
+		writeError(c, http.StatusUnauthorized, errors.New("unauthorized"))
+	}
+}
+
+func providerService(c *gin.Context) (provider.IProviderService, bool) {
+	providerService := service.GetProviderService()
+	if providerService == nil {
+		writeError(c, http.StatusServiceUnavailable, errors.New("providers are not initialized"))
+		return nil, false
+	}
+	return providerService, true
+}
+
+// listAccounts lists the cloud accounts with the names and the access keys of their proxy credentials, the secrets
+// are never returned.
+func (h *Handler) listAccounts(c *gin.Context) {
+	providerService, ok := providerService(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Accounts": providerService.Accounts()})
+}
+
+type disableRequest struct {
+	Duration int // seconds, 0 means until it is enabled
+	Reason   string
+}
+
+func (h *Handler) disableAccount(c *gin.Context) {
+	providerService, ok := providerService(c)
+	if !ok {
+		return
+	}
+	var req disableRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if req.Duration < 0 {
+		writeError(c, http.StatusBadRequest, errors.New("duration cannot be negative"))
+		return
+	}
+	name := c.Param("name")
+	var until time.Time
+	if req.Duration > 0 {
+		until = time.Now().Add(time.Duration(req.Duration) * time.Second)
+	}
+	if err := providerService.DisableAccount(name, until, req.Reason); err != nil {
+		writeError(c, http.StatusNotFound, err)
+		return
+	}
+	logs.CtxWarn(c.Request.Context(), "[Admin] cloud account %s is disabled by %s for %ds, reason: %s", name, c.ClientIP(), req.Duration, req.Reason)
+	c.JSON(http.StatusOK, gin.H{"CloudAccountName": name, "Disabled": true})
+}
+
+func (h *Handler) enableAccount(c *gin.Context) {
+	providerService, ok := providerService(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	wasDisabled := providerService.EnableAccount(name)
+	if wasDisabled {
+		logs.CtxWarn(c.Request.Context(), "[Admin] cloud account %s is enabled by %s", name, c.ClientIP())
+	}
+	c.JSON(http.StatusOK, gin.H{"CloudAccountName": name, "Disabled": false, "WasDisabled": wasDisabled})
+}
+
+func (h *Handler) stats(c *gin.Context) {
+	accounts, since := h.recorder.Stats()
+	c.JSON(http.StatusOK, gin.H{"Since": since, "Accounts": accounts})
+}
+
+func (h *Handler) blocked(c *gin.Context) {
+	limit := defaultBlockedLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(c, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+		limit = parsed
+	}
+	c.JSON(http.StatusOK, gin.H{"Requests": h.recorder.Blocked(limit)})
+}
+
+func (h *Handler) reloadConfig(c *gin.Context) {
+	logs.CtxWarn(c.Request.Context(), "[Admin] reload is triggered by %s", c.ClientIP())
+	if err := h.reload(); err != nil {
+		logs.CtxError(c.Request.Context(), "[Admin] reload config failed, keep serving with the old config: %v", err)
+		writeError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Reloaded": true})
+}
+
+// selfTest signs and validates a sample request with each proxy credential, see provider.SelfTest. It responds 503
+// if any of them failed.
+func (h *Handler) selfTest(c *gin.Context) {
+	providerService, ok := providerService(c)
+	if !ok {
+		return
+	}
+	results := providerService.SelfTest(c.Request.Context())
+	status, code := provider.CheckOK, http.StatusOK
+	for _, result := range results {
+		if result.Status == provider.CheckFailed {
+			status, code = provider.CheckFailed, http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{"Status": status, "Results": results})
+}
+
+type logLevelRequest struct {
+	Level string
+}
+
+func (h *Handler) logLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, logLevelRequest{Level: logs.Level()})
+}
+
+func (h *Handler) setLogLevel(c *gin.Context) {
+	var req logLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+	level := strings.ToLower(req.Level)
+	if err := logs.SetLevel(level); err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+	logs.CtxWarn(c.Request.Context(), "[Admin] log level is set to %s by %s", level, c.ClientIP())
+	c.JSON(http.StatusOK, logLevelRequest{Level: level})
+}
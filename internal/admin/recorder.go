@@ -0,0 +1,160 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package admin
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultMaxBlocked = 100
+
+// Request is a proxied request seen by the recorder.
+type Request struct {
+	Time             time.Time
+	RequestId        string
+	ClientIP         string
+	CloudAccountName string
+	Vendor           string
+	Operation        string   `json:",omitempty"`
+	ProxyCredential  string   `json:",omitempty"`
+	TargetUrl        string   `json:",omitempty"` // redacted
+	ExceptionCode    string   `json:",omitempty"`
+	ShadowViolations []string `json:",omitempty"`
+	HttpStatus       int
+	UpstreamStatus   int `json:",omitempty"`
+	Cost             time.Duration
+}
+
+// AccountStats counts the requests of a cloud account since the proxy started.
+type AccountStats struct {
+	CloudAccountName string
+	Requests         uint64
+	Forwarded        uint64
+	Rejected         uint64
+	ShadowViolations uint64            // requests which would be rejected by the rules in shadow mode
+	Exceptions       map[string]uint64 `json:",omitempty"`
+	UpstreamStatuses map[int]uint64    `json:",omitempty"`
+	AverageCost      time.Duration
+	LastRequestTime  time.Time
+	totalCost        time.Duration
+}
+
+// Recorder keeps the request stats of each cloud account and the recent blocked requests in memory.
+type Recorder struct {
+	mu       sync.Mutex
+	since    time.Time
+	accounts map[string]*AccountStats
+	blocked  []Request // ring buffer, next is the index of the oldest once it is full
+	next     int
+	full     bool
+}
+
+// NewRecorder creates a recorder which keeps at most maxBlocked blocked requests.
+func NewRecorder(maxBlocked int) *Recorder {
+	if maxBlocked <= 0 {
+		maxBlocked = defaultMaxBlocked
+	}
+	return &Recorder{
+		since:    time.Now(),
+		accounts: make(map[string]*AccountStats),
+		blocked:  make([]Request, maxBlocked),
+	}
+}
+
+// Record counts the request under the account. The account should be normalized by the caller, such as with
+// base.MetricLabels, so that the clients cannot grow the stats with arbitrary names.
+func (r *Recorder) Record(account string, req Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, found := r.accounts[account]
+	if !found {
+		stats = &AccountStats{CloudAccountName: account}
+		r.accounts[account] = stats
+	}
+	stats.Requests++
+	stats.totalCost += req.Cost
+	if req.Time.After(stats.LastRequestTime) {
+		stats.LastRequestTime = req.Time
+	}
+	if len(req.ShadowViolations) > 0 {
+		stats.ShadowViolations++
+	}
+	if req.UpstreamStatus != 0 {
+		if stats.UpstreamStatuses == nil {
+			stats.UpstreamStatuses = make(map[int]uint64)
+		}
+		stats.UpstreamStatuses[req.UpstreamStatus]++
+	}
+	if req.ExceptionCode == "" {
+		stats.Forwarded++
+		return
+	}
+	stats.Rejected++
+	if stats.Exceptions == nil {
+		stats.Exceptions = make(map[string]uint64)
+	}
+	stats.Exceptions[req.ExceptionCode]++
+	r.blocked[r.next] = req
+	r.next = (r.next + 1) % len(r.blocked)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Stats returns the copies of the stats sorted by the names, and the time since when they are counted.
+func (r *Recorder) Stats() ([]AccountStats, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	accounts := make([]AccountStats, 0, len(r.accounts))
+	for _, stats := range r.accounts {
+		copied := *stats
+		copied.Exceptions = copyMap(stats.Exceptions)
+		if stats.UpstreamStatuses != nil {
+			copied.UpstreamStatuses = make(map[int]uint64, len(stats.UpstreamStatuses))
+			for status, count := range stats.UpstreamStatuses {
+				copied.UpstreamStatuses[status] = count
+			}
+		}
+		copied.AverageCost = stats.totalCost / time.Duration(stats.Requests)
+		accounts = append(accounts, copied)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].CloudAccountName < accounts[j].CloudAccountName
+	})
+	return accounts, r.since
+}
+
+// Blocked returns at most limit recent blocked requests, newest first.
+func (r *Recorder) Blocked(limit int) []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := r.next
+	if r.full {
+		count = len(r.blocked)
+	}
+	if limit <= 0 || limit > count {
+		limit = count
+	}
+	blocked := make([]Request, 0, limit)
+	for i := 1; i <= limit; i++ {
+		blocked = append(blocked, r.blocked[(r.next-i+len(r.blocked))%len(r.blocked)])
+	}
+	return blocked
+}
+
+func copyMap(m map[string]uint64) map[string]uint64 {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]uint64, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,245 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	DecisionForwarded = "forwarded"
+	DecisionRejected  = "rejected"
+
+	DefaultOutput  = "./output/audit"
+	MinKeyLength   = 16
+	defaultMaxSize = 100
+	fileName       = "audit.log"
+	filePrefix     = "audit"
+	fileExtension  = ".log"
+	hashPrefix     = `,"Hash":"`
+	maxLineSize    = 64 << 10
+)
+
+// Record is written for each proxied request.
+type Record struct {
+	Seq              uint64
+	Time             time.Time
+	RequestId        string
+	ClientIP         string
+	CloudAccountName string
+	Vendor           string
+	Operation        string
+	ProxyCredential  string // name of the proxy credential which the request is signed with
+	ProxyAccessKey   string
+	Decision         string
+	ExceptionCode    string   `json:",omitempty"`
+	ShadowViolations []string `json:",omitempty"`
+	HttpStatus       int
+	UpstreamStatus   int `json:",omitempty"` // 0 if the request was not forwarded or the vendor did not respond
+	PrevHash         string
+}
+
+// Anchor is the last record of the chain at a time. Kept outside the audit files, it reveals the records truncated
+// from the end of the chain, which the chain itself cannot tell.
+type Anchor struct {
+	Seq  uint64
+	Hash string
+}
+
+// Writer writes the records into rotated files as JSON lines. The records are hash-chained: each line ends with the
+// HMAC-SHA256 of the line before the hash, which contains the hash of the previous record, so a modified or deleted
+// record breaks the chain, and the chain cannot be rebuilt without the key.
+type Writer struct {
+	mu       sync.Mutex
+	out      *lumberjack.Logger
+	key      []byte
+	seq      uint64
+	prevHash string
+	anchored uint64 // seq of the last anchor
+}
+
+// NewWriter opens the audit file and continues the chain of the records already written, which must have been
+// chained with the same key.
+func NewWriter(conf common.Audit, key []byte) (*Writer, error) {
+	if len(key) < MinKeyLength {
+		return nil, fmt.Errorf("Audit.Key must have at least %d characters", MinKeyLength)
+	}
+	dir := conf.Output
+	if dir == "" {
+		dir = DefaultOutput
+	}
+	maxSize := conf.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		out: &lumberjack.Logger{
+			Filename: filepath.Join(dir, fileName),
+			MaxAge:   conf.MaxAge,
+			MaxSize:  maxSize,
+		},
+		key: key,
+	}
+	files, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	// the newest file may be empty right after rotating
+	for i := len(files) - 1; i >= 0; i-- {
+		line, err := lastLine(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			continue
+		}
+		record, hash, err := parseLine(line, key)
+		if err != nil {
+			return nil, fmt.Errorf("the last audit record in %s is broken or chained with another key, check it with verify-audit: %v", files[i], err)
+		}
+		w.seq, w.prevHash, w.anchored = record.Seq, hash, record.Seq
+		break
+	}
+	return w, nil
+}
+
+// Write numbers the record, chains it to the previous one and writes it. The written line is returned without the
+// newline, so that it can be exported as is.
+func (w *Writer) Write(record Record) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	record.Seq = w.seq + 1
+	record.PrevHash = w.prevHash
+	body, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	hash := hashOf(w.key, body)
+	line := make([]byte, 0, len(body)+len(hashPrefix)+len(hash)+3)
+	line = append(line, body[:len(body)-1]...)
+	line = append(line, hashPrefix...)
+	line = append(line, hash...)
+	line = append(line, "\"}\n"...)
+	if _, err := w.out.Write(line); err != nil {
+		return nil, err
+	}
+	w.seq, w.prevHash = record.Seq, hash
+	return line[:len(line)-1], nil
+}
+
+// Anchor returns the last record of the chain, false if no record has been written since the last anchor.
+func (w *Writer) Anchor() (Anchor, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seq == w.anchored {
+		return Anchor{}, false
+	}
+	w.anchored = w.seq
+	return Anchor{Seq: w.seq, Hash: w.prevHash}, true
+}
+
+func (w *Writer) Close() error {
+	return w.out.Close()
+}
+
+func hashOf(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseLine splits the line into the record and its hash, and checks the hash with the key.
+func parseLine(line, key []byte) (Record, string, error) {
+	var record Record
+	index := bytes.LastIndex(line, []byte(hashPrefix))
+	if index < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return record, "", fmt.Errorf("hash is missing")
+	}
+	hash := string(line[index+len(hashPrefix) : len(line)-2])
+	body := append(append([]byte(nil), line[:index]...), '}')
+	if err := json.Unmarshal(body, &record); err != nil {
+		return record, "", err
+	}
+	if !hmac.Equal([]byte(hashOf(key, body)), []byte(hash)) {
+		return record, "", fmt.Errorf("hash mismatch, the record (seq: %d) was modified or chained with another key", record.Seq)
+	}
+	return record, hash, nil
+}
+
+// Files lists the audit files in the directory from the oldest to the newest.
+func Files(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var backups []string
+	current := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileExtension) {
+			continue
+		}
+		if name == fileName {
+			current = filepath.Join(dir, name)
+			continue
+		}
+		// the backups are named by the time they were rotated, like audit-2006-01-02T15-04-05.000.log
+		backups = append(backups, filepath.Join(dir, name))
+	}
+	sort.Strings(backups)
+	if current != "" {
+		backups = append(backups, current)
+	}
+	return backups, nil
+}
+
+// lastLine reads the last non-empty line of the file, nil is returned if the file is empty.
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - maxLineSize
+	if offset < 0 {
+		offset = 0
+	}
+	data := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return data[bytes.LastIndexByte(data, '\n')+1:], nil
+}
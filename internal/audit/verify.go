@@ -0,0 +1,97 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// VerifyResult summarizes the verified chain. Records older than FirstSeq may have been removed by the rotation,
+// and the records after LastHash cannot be told from never written ones, so truncation is detected by verifying
+// with an anchor kept somewhere else.
+type VerifyResult struct {
+	Files         int
+	Records       int
+	FirstSeq      uint64
+	FirstPrevHash string
+	LastSeq       uint64
+	LastHash      string
+}
+
+// Verify checks the hash of each record with the key and the chain across the files, which must be given from the
+// oldest to the newest. The first broken record is reported with its file and line. If the anchor is not nil, the
+// chain must contain the anchored record.
+func Verify(files []string, key []byte, anchor *Anchor) (VerifyResult, error) {
+	var result VerifyResult
+	anchorHash := ""
+	for _, path := range files {
+		if err := verifyFile(path, key, &result, func(record Record, hash string) {
+			if anchor != nil && record.Seq == anchor.Seq {
+				anchorHash = hash
+			}
+		}); err != nil {
+			return result, err
+		}
+		result.Files++
+	}
+	if anchor == nil {
+		return result, nil
+	}
+	if anchor.Seq > result.LastSeq {
+		return result, fmt.Errorf("the chain ends at seq %d before the anchor (seq: %d), records were truncated", result.LastSeq, anchor.Seq)
+	}
+	if anchor.Seq < result.FirstSeq {
+		return result, fmt.Errorf("the anchor (seq: %d) is older than the chain, which starts at seq %d", anchor.Seq, result.FirstSeq)
+	}
+	if anchorHash != anchor.Hash {
+		return result, fmt.Errorf("the hash of the record (seq: %d) does not match the anchor", anchor.Seq)
+	}
+	return result, nil
+}
+
+// verifyFile verifies the records of the file, and calls visit with each of them.
+func verifyFile(path string, key []byte, result *VerifyResult, visit func(record Record, hash string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, maxLineSize), maxLineSize)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record, hash, err := parseLine(line, key)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		if result.Records == 0 {
+			result.FirstSeq, result.FirstPrevHash = record.Seq, record.PrevHash
+		} else {
+			if record.PrevHash != result.LastHash {
+				return fmt.Errorf("%s:%d: chain is broken before the record (seq: %d), records were deleted or reordered",
+					path, lineNumber, record.Seq)
+			}
+			if record.Seq != result.LastSeq+1 {
+				return fmt.Errorf("%s:%d: seq %d follows %d", path, lineNumber, record.Seq, result.LastSeq)
+			}
+		}
+		visit(record, hash)
+		result.Records++
+		result.LastSeq, result.LastHash = record.Seq, hash
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
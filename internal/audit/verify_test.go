@@ -0,0 +1,142 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+// writeChain writes the records with a new writer in the directory, and returns the lines of the audit file and the
+// anchor of the last record.
+func writeChain(t *testing.T, dir string, accounts ...string) ([][]byte, Anchor) {
+	w, err := NewWriter(common.Audit{Output: dir}, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, account := range accounts {
+		if _, err = w.Write(Record{CloudAccountName: account, Decision: DecisionForwarded, HttpStatus: 200}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	anchor, _ := w.Anchor()
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n")), anchor
+}
+
+// writeLines writes the lines as an audit file and returns its path.
+func writeLines(t *testing.T, lines [][]byte) string {
+	path := filepath.Join(t.TempDir(), fileName)
+	if err := ioutil.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	lines, anchor := writeChain(t, t.TempDir(), "a", "b", "c", "d", "e")
+	if anchor.Seq != 5 {
+		t.Fatalf("anchor is %+v, want seq 5", anchor)
+	}
+	pick := func(indexes ...int) [][]byte {
+		picked := make([][]byte, 0, len(indexes))
+		for _, i := range indexes {
+			picked = append(picked, lines[i])
+		}
+		return picked
+	}
+	modified := pick(0, 1, 2, 3, 4)
+	modified[2] = bytes.Replace(modified[2], []byte(`"CloudAccountName":"c"`), []byte(`"CloudAccountName":"x"`), 1)
+	cases := []struct {
+		name   string
+		lines  [][]byte
+		key    []byte
+		anchor *Anchor
+		err    string // empty if the chain is intact
+	}{
+		{"intact", pick(0, 1, 2, 3, 4), testKey, nil, ""},
+		{"intact with anchor", pick(0, 1, 2, 3, 4), testKey, &anchor, ""},
+		{"intact with an older anchor", pick(0, 1, 2, 3, 4), testKey, &Anchor{Seq: 2, Hash: hashOfLine(t, lines[1])}, ""},
+		{"oldest records rotated away", pick(2, 3, 4), testKey, nil, ""},
+		{"modified record", modified, testKey, nil, "hash mismatch, the record (seq: 3) was modified"},
+		{"deleted record", pick(0, 1, 3, 4), testKey, nil, "chain is broken before the record (seq: 4)"},
+		{"reordered records", pick(0, 2, 1, 3, 4), testKey, nil, "chain is broken before the record (seq: 3)"},
+		{"duplicated record", pick(0, 1, 1, 2, 3, 4), testKey, nil, "chain is broken before the record (seq: 2)"},
+		{"another key", pick(0, 1, 2, 3, 4), []byte("fedcba9876543210"), nil, "hash mismatch"},
+		{"truncated records without anchor", pick(0, 1, 2), testKey, nil, ""},
+		{"truncated records", pick(0, 1, 2), testKey, &anchor, "the chain ends at seq 3 before the anchor (seq: 5)"},
+		{"anchor older than the chain", pick(3, 4), testKey, &Anchor{Seq: 2, Hash: hashOfLine(t, lines[1])}, "older than the chain"},
+		{"anchor of another chain", pick(0, 1, 2, 3, 4), testKey, &Anchor{Seq: 5, Hash: strings.Repeat("0", 64)}, "does not match the anchor"},
+		{"missing hash", [][]byte{[]byte(`{"Seq":1}`)}, testKey, nil, "hash is missing"},
+	}
+	for _, c := range cases {
+		_, err := Verify([]string{writeLines(t, c.lines)}, c.key, c.anchor)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: error is %v, want %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestVerifyFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeChain(t, dir, "a", "b", "c")
+	// the writer continues the chain of the existing records
+	lines, anchor := writeChain(t, dir, "d", "e")
+	if len(lines) != 5 || anchor.Seq != 5 {
+		t.Fatalf("%d lines are written, anchor is %+v", len(lines), anchor)
+	}
+	older, newer := writeLines(t, lines[:3]), writeLines(t, lines[3:])
+	result, err := Verify([]string{older, newer}, testKey, &anchor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 2 || result.Records != 5 || result.FirstSeq != 1 || result.LastSeq != 5 || result.LastHash != anchor.Hash {
+		t.Errorf("result is %+v", result)
+	}
+	if _, err = Verify([]string{newer, older}, testKey, nil); err == nil || !strings.Contains(err.Error(), "chain is broken") {
+		t.Errorf("files out of order: error is %v", err)
+	}
+}
+
+func TestNewWriterRejectsBrokenChain(t *testing.T) {
+	dir := t.TempDir()
+	lines, _ := writeChain(t, dir, "a", "b")
+	lines[1] = bytes.Replace(lines[1], []byte(`"CloudAccountName":"b"`), []byte(`"CloudAccountName":"x"`), 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, fileName), append(bytes.Join(lines, []byte("\n")), '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWriter(common.Audit{Output: dir}, testKey); err == nil {
+		t.Errorf("writer continues a broken chain")
+	}
+	if _, err := NewWriter(common.Audit{Output: t.TempDir()}, []byte("short")); err == nil {
+		t.Errorf("writer accepts a short key")
+	}
+}
+
+func hashOfLine(t *testing.T, line []byte) string {
+	_, hash, err := parseLine(line, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
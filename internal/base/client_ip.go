@@ -0,0 +1,53 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package base
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/volcengine/key-proxy/internal/utils"
+)
+
+const forwardedForKey = "X-Forwarded-For"
+
+type unixSocketKey struct{}
+
+// WithUnixSocket marks the context of a connection accepted by the unix socket listener.
+func WithUnixSocket(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unixSocketKey{}, true)
+}
+
+// ResolveClientIP gets the ip of the client, or utils.UnixSocketClient for the clients of the unix socket listener.
+// X-Forwarded-For is only used when the request comes from the trusted proxies, and the addresses appended by the
+// trusted proxies are skipped from right to left. The unix socket clients are not trusted unless "unix" is listed.
+func ResolveClientIP(req *http.Request, trustedProxies utils.IPList) string {
+	remoteIP := req.RemoteAddr
+	if unix, _ := req.Context().Value(unixSocketKey{}).(bool); unix {
+		remoteIP = utils.UnixSocketClient
+	} else if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	if trustedProxies.Empty() {
+		return remoteIP
+	}
+	clientIP := remoteIP
+	hops := strings.Split(strings.Join(req.Header.Values(forwardedForKey), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !trustedProxies.Contains(clientIP) {
+			break
+		}
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" || net.ParseIP(hop) == nil {
+			break
+		}
+		clientIP = hop
+	}
+	return clientIP
+}
@@ -0,0 +1,58 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package base
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/volcengine/key-proxy/internal/utils"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := utils.ParseIPList([]string{"10.0.0.0/8", "192.168.1.1", utils.UnixSocketClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name           string
+		remoteAddr     string
+		unix           bool
+		forwardedFor   []string
+		trustedProxies utils.IPList
+		clientIP       string
+	}{
+		{"no trusted proxies", "10.0.0.1:1234", false, []string{"1.1.1.1"}, utils.IPList{}, "10.0.0.1"},
+		{"direct client", "2.2.2.2:1234", false, nil, trusted, "2.2.2.2"},
+		{"untrusted peer", "2.2.2.2:1234", false, []string{"1.1.1.1"}, trusted, "2.2.2.2"},
+		{"one trusted proxy", "10.0.0.1:1234", false, []string{"1.1.1.1"}, trusted, "1.1.1.1"},
+		{"trusted proxies are skipped", "10.0.0.1:1234", false, []string{"1.1.1.1, 192.168.1.1, 10.2.3.4"}, trusted, "1.1.1.1"},
+		{"spoofed hops before the client", "10.0.0.1:1234", false, []string{"6.6.6.6, 1.1.1.1, 10.2.3.4"}, trusted, "1.1.1.1"},
+		{"spoofed trusted hop before the client", "10.0.0.1:1234", false, []string{"10.9.9.9, 1.1.1.1"}, trusted, "1.1.1.1"},
+		{"multiple headers", "10.0.0.1:1234", false, []string{"6.6.6.6, 1.1.1.1", "10.2.3.4"}, trusted, "1.1.1.1"},
+		{"all hops trusted", "10.0.0.1:1234", false, []string{"10.1.1.1, 10.2.2.2"}, trusted, "10.1.1.1"},
+		{"invalid hop", "10.0.0.1:1234", false, []string{"1.1.1.1, garbage"}, trusted, "10.0.0.1"},
+		{"empty hop", "10.0.0.1:1234", false, []string{"1.1.1.1, "}, trusted, "10.0.0.1"},
+		{"empty header", "10.0.0.1:1234", false, []string{""}, trusted, "10.0.0.1"},
+		{"ipv6 proxy", "[fd00::1]:1234", false, []string{"2001:db8::1"}, trusted, "fd00::1"},
+		{"unix socket client", "@", true, nil, utils.IPList{}, utils.UnixSocketClient},
+		{"trusted unix socket proxy", "@", true, []string{"1.1.1.1"}, trusted, "1.1.1.1"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		if c.unix {
+			req = req.WithContext(WithUnixSocket(req.Context()))
+		}
+		for _, value := range c.forwardedFor {
+			req.Header.Add(forwardedForKey, value)
+		}
+		if clientIP := ResolveClientIP(req, c.trustedProxies); clientIP != c.clientIP {
+			t.Errorf("%s: client ip is %s, want %s", c.name, clientIP, c.clientIP)
+		}
+	}
+}
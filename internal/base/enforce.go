@@ -0,0 +1,66 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package base
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const (
+	// ModeEnforce blocks the requests violating the rule.
+	ModeEnforce = "enforce"
+	// ModeShadow logs and reports the requests violating the rule, but still forwards them.
+	ModeShadow = "shadow"
+	// ModeOff ignores the rule.
+	ModeOff = "off"
+	// ModeQuarantine records the requests violating the rule as evidences and rejects them with a synthetic error.
+	ModeQuarantine = "quarantine"
+)
+
+var shadowViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "key_proxy_shadow_violations_total",
+	Help: "Requests which would have been blocked by the rules in shadow mode.",
+}, []string{"exception"})
+
+// RuleMode gets the mode of the rule, the legacy switch is used if the mode is not configured.
+func RuleMode(rule common.ForbiddenRule, legacyForbidden bool, defaultMode string) string {
+	if rule.Mode != "" {
+		return rule.Mode
+	}
+	if legacyForbidden {
+		return ModeEnforce
+	}
+	return defaultMode
+}
+
+// ValidateRuleMode checks the mode is one of enforce, shadow and off.
+func ValidateRuleMode(mode string) error {
+	switch mode {
+	case "", ModeEnforce, ModeShadow, ModeOff, ModeQuarantine:
+		return nil
+	}
+	return fmt.Errorf("unknown mode: %q, available modes are: [%s, %s, %s, %s]", mode, ModeEnforce, ModeShadow, ModeOff, ModeQuarantine)
+}
+
+// Enforce raises the exception if the mode is enforce. In shadow mode, it logs the exception,
+// records it into the request state and counts it instead, so the request is still forwarded.
+func Enforce(ctx context.Context, mode string, exception Exception) {
+	switch mode {
+	case ModeEnforce, ModeQuarantine:
+		panic(exception)
+	case ModeShadow:
+		logs.CtxWarn(ctx, "[Shadow] request would have been blocked: %s", RedactText(exception.Error()))
+		GetRequestState(ctx).AddShadowViolation(exception.Code)
+		shadowViolations.WithLabelValues(exception.Code).Inc()
+	}
+}
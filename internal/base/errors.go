@@ -9,9 +9,20 @@ package base
 var (
 	InternalError                 = NewException(500, "InternalError", "There was an internal error occurred.", "内部错误，请重试或联系客服人员解决。")
 	CloudAccountNotFound          = NewException(404, "CloudAccountNotFound", "The cloud account is not found in the config.", "在配置中未找到对应的账号。")
+	CloudAccountDisabled          = NewException(403, "CloudAccountDisabled", "The cloud account is disabled by the administrator temporarily.", "该云账号已被管理员临时禁用。")
 	ValidateCredentialErr         = NewException(401, "ValidateCredentialErr", "The proxy credential provided does not match the configuration.", "提供的代理秘钥与配置不符。")
 	ResignInternalErr             = NewException(500, "ResignInternalErr", "There was an internal error occurred during resigning.", "签算时发生内部错误。")
 	ValidateCredentialInternalErr = NewException(500, "ValidateCredentialInternalErr", "There was an internal error occurred during validating.", "验证签算时发生内部错误。")
 	ReformRequestInternalErr      = NewException(500, "ReformRequestInternalErr", "There was an internal error occurred during reforming the request.", "处理请求时发生内部错误。")
+	RequestExpired                = NewException(401, "RequestExpired", "The signing time of the request is out of the allowed clock skew.", "请求签名时间超出允许的时间偏差范围。")
+	RequestReplayed               = NewException(401, "RequestReplayed", "The request has been received before and is rejected as a replay.", "请求已被处理过，疑似重放请求，已拒绝。")
+	ReplayCacheFull               = NewException(503, "ReplayCacheFull", "Too many recent requests to check for replays, please retry later.", "近期请求过多，无法进行防重放校验，请稍后重试。")
+	UpstreamHostForbidden         = NewException(403, "UpstreamHostForbidden", "The target host of the request is not allowed.", "请求的目标地址不在允许范围内。")
+	ClientCertForbidden           = NewException(403, "ClientCertForbidden", "The client certificate is not allowed to access the cloud account.", "客户端证书无权访问该云账号。")
+	ClientIPForbidden             = NewException(403, "ClientIPForbidden", "The client ip is not allowed to access the proxy or the cloud account.", "客户端IP无权访问代理或该云账号。")
+	OperationForbidden            = NewException(403, "OperationForbidden", "The operation is not allowed by the policy of the cloud account.", "云账号的策略不允许该操作。")
+	ReadOnlyAccount               = NewException(403, "ReadOnlyAccount", "The cloud account is read-only, the operation which may change resources is not allowed.", "该云账号为只读账号，不允许执行可能变更资源的操作。")
+	ProxyCredentialExpired        = NewException(401, "ProxyCredentialExpired", "The proxy credential has expired, please rotate it.", "代理秘钥已过期，请轮换代理秘钥。")
+	RequestQuarantined            = NewException(401, "RequestQuarantined", "The access key or the signature of the request is invalid.", "请求的访问密钥或签名无效。")
 	NetworkErr                    = NewException(502, "NetworkErr", "There was a network error occurred during requesting.", "请求厂商时发生网络错误。")
 )
@@ -16,7 +16,8 @@ type Exception struct {
 	Code       string
 	Message    string
 	MessageCn  string
-	RawError   string // 原始错误信息字符串
+	RawError   string          // 原始错误信息字符串
+	Response   *VendorResponse // 以云厂商格式返回的错误，为空时返回代理的错误
 }
 
 const textCodePrefix = "Proxy."
@@ -57,6 +58,12 @@ func (e Exception) WithRawErrorStr(s string) Exception {
 	return e
 }
 
+// WithResponse responds the error in the format of the vendor instead of the proxy.
+func (e Exception) WithResponse(response VendorResponse) Exception {
+	e.Response = &response
+	return e
+}
+
 func (e Exception) WithStatusCode(code int) Exception {
 	e.StatusCode = code
 	return e
@@ -7,9 +7,11 @@ Use of this source code is governed by the license that can be found in the LICE
 package base
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/config"
 	"github.com/volcengine/key-proxy/internal/utils"
 	"net/http"
 	"time"
@@ -51,6 +53,13 @@ type ErrorObj struct {
 	Detail  string `json:",omitempty"`
 }
 
+// VendorResponse is an error response in the format of a cloud vendor.
+type VendorResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
 type TraceInfo struct {
 	RequestId   string
 	RequestTime time.Time
@@ -64,6 +73,7 @@ type McdnArgs struct {
 	CloudAccountName string
 	SubProduct       string
 	Version          string
+	ClientIP         string
 }
 
 func (e *ErrorObj) Error() string {
@@ -85,6 +95,7 @@ func NewMcdnArgs(c *gin.Context) McdnArgs {
 		CloudAccountName: c.GetHeader(CloudAccountNameKey),
 		SubProduct:       c.GetHeader(SubProductKey),
 		Version:          Version,
+		ClientIP:         ResolveClientIP(c.Request, config.FromContext(c.Request.Context()).TrustedProxies),
 	}
 }
 
@@ -100,6 +111,7 @@ func NewBaseInfo(c *gin.Context, mcdnArgs McdnArgs) common.BaseInfo {
 		RequestId:        mcdnArgs.RequestId,
 		TargetUrl:        c.GetHeader(OriginUrlKey),
 		ProxyVersion:     Version,
+		ClientIP:         mcdnArgs.ClientIP,
 	}
 }
 
@@ -111,10 +123,13 @@ func GetMcdnArgs(c *gin.Context) McdnArgs {
 	return val.(McdnArgs)
 }
 
+// GetBaseInfo returns the info passed to the hooks, in which the target url is redacted but the request is not.
 func GetBaseInfo(c *gin.Context) common.BaseInfo {
 	val, existed := c.Get(BaseInfoKey)
 	if !existed {
-		return NewBaseInfo(c, GetMcdnArgs(c))
+		info := NewBaseInfo(c, GetMcdnArgs(c))
+		info.TargetUrl = RedactRawURL(info.TargetUrl)
+		return info
 	}
 	return val.(common.BaseInfo)
 }
@@ -125,7 +140,7 @@ func BuildErrorResponse(args McdnArgs, except Exception) *ProxyResponse {
 			Error: &ErrorObj{
 				Code:    except.Code,
 				Message: except.Message,
-				Detail:  except.RawError,
+				Detail:  RedactText(except.RawError),
 			},
 			RequestId:  args.RequestId,
 			Version:    args.Version,
@@ -134,12 +149,40 @@ func BuildErrorResponse(args McdnArgs, except Exception) *ProxyResponse {
 	}
 }
 
+// DumpHttpRequest dumps the request as a curl command, in which the secrets are redacted.
 func DumpHttpRequest(req *http.Request) string {
 	if req == nil {
 		return ""
 	}
-	if cmd, err := utils.GetCurlCommand(req); err == nil {
+	if cmd, err := utils.GetCurlCommand(RedactRequest(req)); err == nil {
 		return cmd.String()
 	}
 	return ""
 }
+
+// ResolveVendor gets the vendor declared by the platform, or the vendor of the cloud account in the config.
+func ResolveVendor(ctx context.Context, args McdnArgs) string {
+	if args.VendorName != "" {
+		return args.VendorName
+	}
+	for _, endpoint := range config.FromContext(ctx).Config.Endpoints {
+		if endpoint.CloudAccountName == args.CloudAccountName {
+			return endpoint.Vendor
+		}
+	}
+	return ""
+}
+
+// MetricLabels gets the vendor and the cloud account to label the metrics with. Cloud accounts which are not in
+// the config are labeled as unknown, so that clients cannot make up unlimited label values.
+func MetricLabels(ctx context.Context, cloudAccountName string) (vendor string, cloudAccount string) {
+	if cloudAccountName == "" {
+		return "", ""
+	}
+	for _, endpoint := range config.FromContext(ctx).Config.Endpoints {
+		if endpoint.CloudAccountName == cloudAccountName {
+			return endpoint.Vendor, endpoint.CloudAccountName
+		}
+	}
+	return "unknown", "unknown"
+}
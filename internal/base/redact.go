@@ -0,0 +1,276 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package base
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/utils"
+)
+
+// Redacted replaces the values of the sensitive keys.
+const Redacted = "******"
+
+// secrets shorter than this are not searched in texts, since they would mask unrelated words
+const minKnownSecretLength = 6
+
+var sensitiveKeys = []string{"authorization", "cookie", "signature", "token", "secret", "password"}
+
+// sensitiveKeyValue matches "key=value" pairs of the sensitive keys in texts, such as the urls in error messages.
+var sensitiveKeyValue = regexp.MustCompile(`(?i)([\w.-]*(?:authorization|signature|token|secret|password)[\w.-]*=)[^&\s,;"']+`)
+
+// RedactionRules lists the headers, query parameters and body fields carrying the secrets or the signatures of the
+// requests to a vendor. Keys containing the sensitive words, such as "signature" and "token", are always redacted.
+type RedactionRules struct {
+	Headers    []string
+	Query      []string
+	BodyFields []string
+}
+
+var (
+	redactionRules = make(map[string]RedactionRules, 16)
+	// sensitiveNames are the lower-cased keys of all vendors, a request may be dumped before its vendor is known
+	sensitiveNames = make(map[string]struct{}, 32)
+)
+
+// RegisterRedactionRules registers the sensitive keys of the vendor, it should be called in init.
+func RegisterRedactionRules(vendor string, rules RedactionRules) {
+	redactionRules[vendor] = rules
+	for _, keys := range [][]string{rules.Headers, rules.Query, rules.BodyFields} {
+		for _, key := range keys {
+			sensitiveNames[strings.ToLower(key)] = struct{}{}
+		}
+	}
+}
+
+// GetRedactionRules returns the sensitive keys registered by the vendor.
+func GetRedactionRules(vendor string) RedactionRules {
+	return redactionRules[vendor]
+}
+
+var knownSecrets = struct {
+	mu       sync.Mutex
+	values   map[string]struct{}
+	replacer atomic.Value // *strings.Replacer
+}{values: make(map[string]struct{})}
+
+// AddKnownSecrets adds the configured secrets, such as the secret keys and the tokens, which are masked wherever they
+// appear in the texts. Secrets are never removed, so that rotated ones are still masked.
+func AddKnownSecrets(secrets ...string) {
+	knownSecrets.mu.Lock()
+	defer knownSecrets.mu.Unlock()
+	changed := false
+	for _, secret := range secrets {
+		if len(secret) < minKnownSecretLength {
+			continue
+		}
+		if _, found := knownSecrets.values[secret]; !found {
+			knownSecrets.values[secret] = struct{}{}
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	values := make([]string, 0, len(knownSecrets.values))
+	for secret := range knownSecrets.values {
+		values = append(values, secret)
+	}
+	// longer secrets go first, so that a secret containing another one is masked as a whole
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	oldnew := make([]string, 0, len(values)*2)
+	for _, secret := range values {
+		oldnew = append(oldnew, secret, Redacted)
+	}
+	knownSecrets.replacer.Store(strings.NewReplacer(oldnew...))
+}
+
+// CredentialSecrets lists the secrets of the credential, the access key is not a secret.
+func CredentialSecrets(credential common.Credential) []string {
+	return []string{credential.SecretKey, credential.AccessToken, credential.ClientToken, credential.ClientSecret}
+}
+
+// IsSensitiveKey reports whether the values of the header, query or form key may contain secrets.
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if _, found := sensitiveNames[key]; found {
+		return true
+	}
+	for _, sensitiveKey := range sensitiveKeys {
+		if strings.Contains(key, sensitiveKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactText masks the known secrets and the values of the sensitive "key=value" pairs in the text.
+func RedactText(text string) string {
+	if replacer, ok := knownSecrets.replacer.Load().(*strings.Replacer); ok {
+		text = replacer.Replace(text)
+	}
+	return sensitiveKeyValue.ReplaceAllString(text, "${1}"+Redacted)
+}
+
+// RedactHeader returns a copy of the header whose sensitive values are redacted.
+func RedactHeader(header http.Header) http.Header {
+	return http.Header(RedactValues(url.Values(header)))
+}
+
+// RedactValues returns a copy of the query or form values whose sensitive values are redacted.
+func RedactValues(values url.Values) url.Values {
+	redacted := make(url.Values, len(values))
+	for key, vs := range values {
+		if IsSensitiveKey(key) {
+			redacted[key] = []string{Redacted}
+			continue
+		}
+		redacted[key] = make([]string, 0, len(vs))
+		for _, v := range vs {
+			redacted[key] = append(redacted[key], RedactText(v))
+		}
+	}
+	return redacted
+}
+
+// RedactURL returns the url whose sensitive query values are redacted.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return redactURL(u).String()
+}
+
+func redactURL(u *url.URL) *url.URL {
+	redacted := *u
+	redacted.User = nil
+	if u.RawQuery != "" {
+		if query, err := url.ParseQuery(u.RawQuery); err == nil {
+			redacted.RawQuery = encodeRedacted(query)
+		} else {
+			redacted.RawQuery = RedactText(u.RawQuery)
+		}
+	}
+	return &redacted
+}
+
+// encodeRedacted encodes the redacted values, keeping the masks readable.
+func encodeRedacted(values url.Values) string {
+	return strings.ReplaceAll(RedactValues(values).Encode(), url.QueryEscape(Redacted), Redacted)
+}
+
+// RedactRawURL is RedactURL for the urls which have not been parsed.
+func RedactRawURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return RedactText(rawURL)
+	}
+	return RedactURL(u)
+}
+
+// RedactBody redacts the sensitive fields of the form or JSON body, other bodies are redacted as texts.
+func RedactBody(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			return encodeRedacted(form)
+		}
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var data interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&data); err == nil {
+			if redacted, err := json.Marshal(redactJSON(data)); err == nil {
+				return string(redacted)
+			}
+		}
+	}
+	return RedactText(string(body))
+}
+
+func redactJSON(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if IsSensitiveKey(key) {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactJSON(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactJSON(value)
+		}
+	case string:
+		return RedactText(v)
+	}
+	return data
+}
+
+// RedactRequest returns a copy of the request whose sensitive headers, query parameters and body fields are
+// redacted, the body of the request is restored. It is meant for dumping and hooks, never for forwarding.
+func RedactRequest(req *http.Request) *http.Request {
+	if req == nil {
+		return nil
+	}
+	redacted := req.Clone(req.Context())
+	redacted.Header = RedactHeader(req.Header)
+	if req.URL != nil {
+		redacted.URL = redactURL(req.URL)
+	}
+	redacted.RequestURI = ""
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := utils.CopyRequestBody(req)
+		if err != nil {
+			body = nil
+		}
+		redactedBody := []byte(RedactBody(req.Header.Get("Content-Type"), body))
+		redacted.Body = ioutil.NopCloser(bytes.NewReader(redactedBody))
+		redacted.ContentLength = int64(len(redactedBody))
+	}
+	return redacted
+}
+
+// RedactBaseInfo returns a copy of the info passed to the hooks, in which the request and the target url are redacted.
+func RedactBaseInfo(info common.BaseInfo) common.BaseInfo {
+	info.Request = RedactRequest(info.Request)
+	info.TargetUrl = RedactRawURL(info.TargetUrl)
+	return info
+}
+
+// RedactOnRequest wraps a custom hook, so that it gets the redacted copy of the request. The request is copied only
+// when the hook is called, the standard hook redacts what it dumps instead.
+func RedactOnRequest(hook common.OnRequest) common.OnRequest {
+	return func(ctx context.Context, requestInfo common.RequestInfo) {
+		requestInfo.BaseInfo = RedactBaseInfo(requestInfo.BaseInfo)
+		hook(ctx, requestInfo)
+	}
+}
+
+// RedactOnResponse is RedactOnRequest for the onResponse hooks.
+func RedactOnResponse(hook common.OnResponse) common.OnResponse {
+	return func(ctx context.Context, response common.ResponseInfo) {
+		response.BaseInfo = RedactBaseInfo(response.BaseInfo)
+		hook(ctx, response)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package base
+
+import (
+	"context"
+	"sync"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+const requestStateKey = "RequestState"
+
+// RequestState collects what happened while proxying the request. It is stored in the context of the request,
+// so that the reverse proxy director can report back to the middlewares.
+type RequestState struct {
+	// BaseInfo is set before the request is proxied, it is read only
+	BaseInfo common.BaseInfo
+
+	mu               sync.Mutex
+	shadowViolations []string
+	proxyCredential  string
+	proxyAccessKey   string
+	operation        string
+	resigned         bool
+	upstreamStatus   int
+}
+
+// WithRequestState stores a new state into the context.
+func WithRequestState(ctx context.Context) (context.Context, *RequestState) {
+	state := &RequestState{}
+	return context.WithValue(ctx, requestStateKey, state), state
+}
+
+// GetRequestState gets the state stored by WithRequestState, an empty state is returned if not found.
+func GetRequestState(ctx context.Context) *RequestState {
+	if state, ok := ctx.Value(requestStateKey).(*RequestState); ok {
+		return state
+	}
+	return &RequestState{}
+}
+
+// AddShadowViolation records the code of an exception which was not raised because its rule is in shadow mode.
+func (s *RequestState) AddShadowViolation(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shadowViolations = append(s.shadowViolations, code)
+}
+
+func (s *RequestState) ShadowViolations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.shadowViolations...)
+}
+
+// SetProxyCredential records the name and the access key of the proxy credential which the request is signed with.
+func (s *RequestState) SetProxyCredential(name, accessKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxyCredential = name
+	s.proxyAccessKey = accessKey
+}
+
+func (s *RequestState) ProxyCredential() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.proxyCredential
+}
+
+func (s *RequestState) ProxyAccessKey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.proxyAccessKey
+}
+
+// SetOperation records the vendor API called by the request.
+func (s *RequestState) SetOperation(operation string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operation = operation
+}
+
+func (s *RequestState) Operation() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.operation
+}
+
+// SetResigned records that the request was resigned with the real credentials, so it is going to be forwarded.
+func (s *RequestState) SetResigned() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resigned = true
+}
+
+func (s *RequestState) Resigned() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resigned
+}
+
+// SetUpstreamStatus records the status code responded by the vendor.
+func (s *RequestState) SetUpstreamStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upstreamStatus = status
+}
+
+func (s *RequestState) UpstreamStatus() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.upstreamStatus
+}
@@ -6,12 +6,87 @@ Use of this source code is governed by the license that can be found in the LICE
 
 package config
 
-import "github.com/volcengine/key-proxy/common"
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/utils"
+)
+
+type snapshotKey struct{}
+
+// Snapshot is a config, the lists parsed from it and the providers built from it. Reloading publishes them together
+// with a single pointer, so a request never pairs the providers of one config with another config.
+type Snapshot struct {
+	Config         *common.Config
+	Providers      interface{} // provider.IProviderService, which cannot be referred to by this package
+	AllowedCIDRs   utils.IPList
+	TrustedProxies utils.IPList
+	AccountCIDRs   map[string]utils.IPList // AllowedCIDRs of the cloud accounts
+}
 
 var (
-	Conf = &common.Config{}
+	current atomic.Value
+	loaded  int32
 )
 
-func MustInit(conf *common.Config) {
-	Conf = conf
+func init() {
+	current.Store(&Snapshot{Config: &common.Config{}})
+}
+
+// NewSnapshot parses the lists of the config, the providers are set by the caller before publishing it.
+func NewSnapshot(c *common.Config) (*Snapshot, error) {
+	snapshot := &Snapshot{Config: c, AccountCIDRs: make(map[string]utils.IPList, len(c.Endpoints))}
+	var err error
+	if snapshot.AllowedCIDRs, err = utils.ParseIPList(c.AllowedCIDRs); err != nil {
+		return nil, fmt.Errorf("invalid AllowedCIDRs: %v", err)
+	}
+	if snapshot.TrustedProxies, err = utils.ParseIPList(c.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TrustedProxies: %v", err)
+	}
+	for _, endpoint := range c.Endpoints {
+		list, err := utils.ParseIPList(endpoint.AllowedCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("cloud account %s: invalid AllowedCIDRs: %v", endpoint.CloudAccountName, err)
+		}
+		snapshot.AccountCIDRs[endpoint.CloudAccountName] = list
+	}
+	return snapshot, nil
+}
+
+// Publish replaces the current snapshot.
+func Publish(snapshot *Snapshot) {
+	current.Store(snapshot)
+	atomic.StoreInt32(&loaded, 1)
+}
+
+// Loaded reports whether a config has been published.
+func Loaded() bool {
+	return atomic.LoadInt32(&loaded) == 1
+}
+
+// Current returns the current snapshot, which may be replaced at any time by reloading.
+func Current() *Snapshot {
+	return current.Load().(*Snapshot)
+}
+
+// Get returns the config of the current snapshot. While handling a request, use FromContext instead, so that the
+// config matches the providers handling the request.
+func Get() *common.Config {
+	return Current().Config
+}
+
+// WithSnapshot binds the snapshot to the context of a request, it is called once when the request arrives.
+func WithSnapshot(ctx context.Context, snapshot *Snapshot) context.Context {
+	return context.WithValue(ctx, snapshotKey{}, snapshot)
+}
+
+// FromContext returns the snapshot bound to the context, or the current one if none is bound.
+func FromContext(ctx context.Context) *Snapshot {
+	if snapshot, ok := ctx.Value(snapshotKey{}).(*Snapshot); ok {
+		return snapshot
+	}
+	return Current()
 }
@@ -0,0 +1,466 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package export
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const (
+	EventRequest  = "request"
+	EventResponse = "response"
+	EventAudit    = "audit"
+	EventAnchor   = "anchor"
+
+	DefaultSpoolDir     = "./output/spool"
+	defaultBufferSize   = 10000
+	defaultMaxRetries   = 3
+	defaultSpoolMaxSize = 100 // megabytes
+	maxBatchSize        = 100
+	minRetryBackoff     = time.Second
+	maxRetryBackoff     = 30 * time.Second
+	replayInterval      = 30 * time.Second
+	overflowSize        = 1000 // events waiting to be spooled
+	dropLogInterval     = 10 * time.Second
+
+	resultSent    = "sent"
+	resultSpooled = "spooled"
+	resultDropped = "dropped"
+)
+
+var (
+	exportedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "key_proxy_export_events_total",
+		Help: "Events handled by the export sinks, by result: sent, spooled or dropped.",
+	}, []string{"sink", "result"})
+	spoolSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "key_proxy_export_spool_bytes",
+		Help: "Bytes of the events spooled to the disk, waiting to be sent again.",
+	}, []string{"sink"})
+)
+
+// Event is the JSON object sent to the sinks.
+type Event struct {
+	Type string
+	Time time.Time
+	Host string
+	Data json.RawMessage
+}
+
+// message is an encoded event, the type and the time are kept for the sinks which frame the events.
+type message struct {
+	Type string
+	Time time.Time
+	Body []byte
+}
+
+// Sink delivers the batches of the events to an external system, a batch is either sent as a whole or failed.
+type Sink interface {
+	Send(ctx context.Context, messages []message) error
+	Close() error
+}
+
+// Exporter sends the events to the sinks in the background. Each sink has a bounded buffer, the events which cannot
+// be buffered or delivered are spooled to the disk by another goroutine and sent again later, so exporting never
+// blocks the requests. The events are dropped if the spooling falls behind as well.
+type Exporter struct {
+	events map[string]bool
+	queues []*queue
+	host   string
+
+	closed    int32
+	stop      chan struct{}
+	abort     context.Context // canceled when Close gives up draining the buffers
+	cancel    context.CancelFunc
+	workers   sync.WaitGroup
+	spoolStop chan struct{}
+	spoolers  sync.WaitGroup
+}
+
+// New creates the sinks and starts sending, nil is returned if no sink is configured.
+func New(conf common.Export) (*Exporter, error) {
+	sinks, names, err := newSinks(conf)
+	if err != nil {
+		return nil, err
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	e := &Exporter{
+		events:    make(map[string]bool, 4),
+		stop:      make(chan struct{}),
+		spoolStop: make(chan struct{}),
+	}
+	e.abort, e.cancel = context.WithCancel(context.Background())
+	e.host, _ = os.Hostname()
+	if len(conf.Events) == 0 {
+		conf.Events = []string{EventRequest, EventResponse, EventAudit, EventAnchor}
+	}
+	for _, event := range conf.Events {
+		switch event {
+		case EventRequest, EventResponse, EventAudit, EventAnchor:
+			e.events[event] = true
+		default:
+			closeSinks(sinks)
+			return nil, fmt.Errorf("unknown export event: %q, available events are: [request, response, audit, anchor]", event)
+		}
+	}
+	bufferSize := conf.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	maxRetries := conf.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	spoolDir := conf.SpoolDir
+	if spoolDir == "" {
+		spoolDir = DefaultSpoolDir
+	}
+	spoolMaxSize := conf.SpoolMaxSize
+	if spoolMaxSize <= 0 {
+		spoolMaxSize = defaultSpoolMaxSize
+	}
+	for i, sink := range sinks {
+		spool, err := openSpool(filepath.Join(spoolDir, names[i]), int64(spoolMaxSize)<<20, names[i])
+		if err != nil {
+			closeSinks(sinks)
+			return nil, fmt.Errorf("open spool of export sink %s failed: %v", names[i], err)
+		}
+		e.queues = append(e.queues, &queue{
+			name:       names[i],
+			sink:       sink,
+			ch:         make(chan message, bufferSize),
+			overflow:   make(chan message, overflowSize),
+			spool:      spool,
+			maxRetries: maxRetries,
+		})
+	}
+	for _, q := range e.queues {
+		e.workers.Add(1)
+		go func(q *queue) {
+			defer e.workers.Done()
+			q.run(e.stop, e.abort)
+		}(q)
+		e.spoolers.Add(1)
+		go func(q *queue) {
+			defer e.spoolers.Done()
+			q.spoolOverflow(e.spoolStop)
+		}(q)
+	}
+	return e, nil
+}
+
+func newSinks(conf common.Export) ([]Sink, []string, error) {
+	var (
+		sinks []Sink
+		names []string
+		seen  = make(map[string]bool)
+	)
+	add := func(name, kind string, index int, newSink func() (Sink, error)) error {
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", kind, index)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate export sink name: %s", name)
+		}
+		seen[name] = true
+		sink, err := newSink()
+		if err != nil {
+			return fmt.Errorf("export sink %s: %v", name, err)
+		}
+		sinks = append(sinks, sink)
+		names = append(names, name)
+		return nil
+	}
+	var err error
+	for i, sinkConf := range conf.Syslog {
+		sinkConf := sinkConf
+		if err = add(sinkConf.Name, "syslog", i, func() (Sink, error) { return newSyslogSink(sinkConf) }); err != nil {
+			break
+		}
+	}
+	for i, sinkConf := range conf.Webhook {
+		if err != nil {
+			break
+		}
+		sinkConf := sinkConf
+		err = add(sinkConf.Name, "webhook", i, func() (Sink, error) { return newWebhookSink(sinkConf) })
+	}
+	for i, sinkConf := range conf.Kafka {
+		if err != nil {
+			break
+		}
+		sinkConf := sinkConf
+		err = add(sinkConf.Name, "kafka", i, func() (Sink, error) { return newKafkaSink(sinkConf) })
+	}
+	if err != nil {
+		closeSinks(sinks)
+		return nil, nil, err
+	}
+	return sinks, names, nil
+}
+
+func closeSinks(sinks []Sink) {
+	for _, sink := range sinks {
+		_ = sink.Close()
+	}
+}
+
+// Export encodes the event and queues it to the sinks, it never blocks. It is a no-op on a nil Exporter or if the
+// type of the event is not exported.
+func (e *Exporter) Export(eventType string, data interface{}) {
+	if e == nil || !e.events[eventType] {
+		return
+	}
+	var raw json.RawMessage
+	switch v := data.(type) {
+	case []byte:
+		raw = v
+	default:
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			logs.CtxWarn(context.Background(), "[Export] encode %s event failed: %v", eventType, err)
+			return
+		}
+		raw = encoded
+	}
+	now := time.Now()
+	body, err := json.Marshal(Event{Type: eventType, Time: now, Host: e.host, Data: raw})
+	if err != nil {
+		logs.CtxWarn(context.Background(), "[Export] encode %s event failed: %v", eventType, err)
+		return
+	}
+	msg := message{Type: eventType, Time: now, Body: body}
+	closed := atomic.LoadInt32(&e.closed) == 1
+	for _, q := range e.queues {
+		if !closed {
+			select {
+			case q.ch <- msg:
+				continue
+			default:
+			}
+		}
+		select {
+		case q.overflow <- msg:
+		default:
+			q.spool.drop(1)
+		}
+	}
+}
+
+// Close sends the buffered events until the context is done, the events left are spooled.
+func (e *Exporter) Close(ctx context.Context) error {
+	if e == nil || !atomic.CompareAndSwapInt32(&e.closed, 0, 1) {
+		return nil
+	}
+	close(e.stop)
+	done := make(chan struct{})
+	go func() {
+		e.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		e.cancel()
+		<-done
+	}
+	e.cancel()
+	close(e.spoolStop)
+	e.spoolers.Wait()
+	var errs []string
+	for _, q := range e.queues {
+		// the events exported while closing are spooled here, the later ones are dropped
+		q.spoolPending()
+		if err := q.sink.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("close export sink %s failed: %v", q.name, err))
+		}
+		if err := q.spool.close(); err != nil {
+			errs = append(errs, fmt.Sprintf("close spool of export sink %s failed: %v", q.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// queue buffers the events of a sink and sends them in batches.
+type queue struct {
+	name       string
+	sink       Sink
+	ch         chan message
+	overflow   chan message // events which did not fit in the buffer, waiting to be spooled
+	spool      *spool
+	maxRetries int
+}
+
+func (q *queue) run(stop <-chan struct{}, abort context.Context) {
+	ticker := time.NewTicker(replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-q.ch:
+			q.deliver(abort, takeBatch(q.ch, msg))
+		case <-ticker.C:
+			q.replay(abort)
+		case <-stop:
+			// drain the buffer, the events are spooled once the shutdown times out
+			for {
+				select {
+				case msg := <-q.ch:
+					q.deliver(abort, takeBatch(q.ch, msg))
+					continue
+				default:
+				}
+				return
+			}
+		}
+	}
+}
+
+// spoolOverflow spools the events which did not fit in the buffer, and reports the dropped events periodically.
+func (q *queue) spoolOverflow(stop <-chan struct{}) {
+	ticker := time.NewTicker(dropLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-q.overflow:
+			q.spool.append(takeBatch(q.overflow, msg))
+		case <-ticker.C:
+			q.spool.reportDropped()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// spoolPending spools the events left in the overflow once spoolOverflow has returned.
+func (q *queue) spoolPending() {
+	for {
+		select {
+		case msg := <-q.overflow:
+			q.spool.append(takeBatch(q.overflow, msg))
+		default:
+			q.spool.reportDropped()
+			return
+		}
+	}
+}
+
+// takeBatch takes the events after the first one from the channel, up to maxBatchSize.
+func takeBatch(ch chan message, first message) []message {
+	batch := []message{first}
+	for len(batch) < maxBatchSize {
+		select {
+		case msg := <-ch:
+			batch = append(batch, msg)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// deliver sends the batch, and spools it if all the retries failed.
+func (q *queue) deliver(ctx context.Context, batch []message) {
+	if err := q.send(ctx, batch); err != nil {
+		logs.CtxWarn(context.Background(), "[Export] send %d events to sink %s failed, spooling them: %v", len(batch), q.name, err)
+		q.spool.append(batch)
+	}
+}
+
+func (q *queue) send(ctx context.Context, batch []message) error {
+	backoff := minRetryBackoff
+	var err error
+	for attempt := 0; attempt <= q.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+		if ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
+			}
+			return err
+		}
+		if err = q.sink.Send(ctx, batch); err == nil {
+			exportedEvents.WithLabelValues(q.name, resultSent).Add(float64(len(batch)))
+			return nil
+		}
+	}
+	return err
+}
+
+// replay sends the spooled events once, the file which failed is kept for the next replay.
+func (q *queue) replay(ctx context.Context) {
+	for _, file := range q.spool.seal() {
+		err := readSpoolFile(file, maxBatchSize, func(batch []message) error {
+			if err := q.sink.Send(ctx, batch); err != nil {
+				return err
+			}
+			exportedEvents.WithLabelValues(q.name, resultSent).Add(float64(len(batch)))
+			return nil
+		})
+		if err != nil {
+			logs.CtxWarn(context.Background(), "[Export] replay spooled events to sink %s failed: %v", q.name, err)
+			// events before the failed batch were sent, they are sent again on the next replay
+			return
+		}
+		q.spool.remove(file)
+	}
+}
+
+// tlsConfig builds the client TLS config of the sinks.
+func tlsConfig(conf common.ClientTls) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if conf.CaFile != "" {
+		caBundle, err := os.ReadFile(conf.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", conf.CaFile)
+		}
+		config.RootCAs = pool
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"github.com/volcengine/key-proxy/common"
+)
+
+const kafkaDialTimeout = 10 * time.Second
+
+// kafkaSink produces each event as a message keyed by its type. The retries are left to the queue, so that the
+// failed batches are spooled instead of retried in the writer.
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(conf common.KafkaSink) (Sink, error) {
+	if len(conf.Brokers) == 0 {
+		return nil, errors.New("brokers are empty")
+	}
+	if conf.Topic == "" {
+		return nil, errors.New("topic is empty")
+	}
+	transport := &kafka.Transport{
+		ClientID:    defaultSyslogAppName,
+		DialTimeout: kafkaDialTimeout,
+	}
+	if conf.Tls.Enabled {
+		config, err := tlsConfig(conf.Tls)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLS = config
+	}
+	mechanism, err := saslMechanism(conf.Sasl)
+	if err != nil {
+		return nil, err
+	}
+	transport.SASL = mechanism
+	return &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(conf.Brokers...),
+			Topic:        conf.Topic,
+			Balancer:     &kafka.LeastBytes{},
+			MaxAttempts:  1,
+			BatchSize:    maxBatchSize,
+			BatchTimeout: 10 * time.Millisecond,
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		},
+	}, nil
+}
+
+func saslMechanism(conf common.Sasl) (sasl.Mechanism, error) {
+	switch strings.ToUpper(conf.Mechanism) {
+	case "":
+		return nil, nil
+	case "PLAIN":
+		return plain.Mechanism{Username: conf.Username, Password: conf.Password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, conf.Username, conf.Password)
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, conf.Username, conf.Password)
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism: %q, available mechanisms are: [PLAIN, SCRAM-SHA-256, SCRAM-SHA-512]", conf.Mechanism)
+	}
+}
+
+func (s *kafkaSink) Send(ctx context.Context, messages []message) error {
+	kafkaMessages := make([]kafka.Message, 0, len(messages))
+	for _, msg := range messages {
+		kafkaMessages = append(kafkaMessages, kafka.Message{
+			Key:   []byte(msg.Type),
+			Value: msg.Body,
+			Time:  msg.Time,
+		})
+	}
+	return s.writer.WriteMessages(ctx, kafkaMessages...)
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,208 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const (
+	spoolFileSuffix = ".jsonl"
+	maxEventSize    = 16 << 20
+)
+
+// spool keeps the undelivered events of a sink in JSON lines files. Events are appended to the open file, which is
+// sealed before replaying, so the files are replayed in the order they were written.
+type spool struct {
+	dropped uint64 // events dropped since the last report, accessed atomically
+	lastErr error  // the last write error since the last report, guarded by mu
+	mu      sync.Mutex
+	dir     string
+	sink    string
+	maxSize int64
+	size    int64
+	file    *os.File // nil until an event is spooled after the last seal
+	sizes   map[string]int64
+}
+
+func openSpool(dir string, maxSize int64, sink string) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &spool{dir: dir, sink: sink, maxSize: maxSize, sizes: make(map[string]int64)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolFileSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.sizes[filepath.Join(dir, entry.Name())] = info.Size()
+		s.size += info.Size()
+	}
+	spoolSize.WithLabelValues(sink).Set(float64(s.size))
+	return s, nil
+}
+
+// append writes the events to the disk, the events beyond the max size of the spool are dropped.
+// The failures are reported by reportDropped, so that a full disk does not flood the logs.
+func (s *spool) append(messages []message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var dropped int
+	for _, msg := range messages {
+		size := int64(len(msg.Body)) + 1
+		if s.size+size > s.maxSize {
+			dropped++
+			continue
+		}
+		// the body is shared by the sinks, so the line is copied
+		line := make([]byte, 0, size)
+		if err := s.write(append(append(line, msg.Body...), '\n')); err != nil {
+			s.lastErr = err
+			dropped++
+			continue
+		}
+		s.size += size
+		s.sizes[s.file.Name()] += size
+		exportedEvents.WithLabelValues(s.sink, resultSpooled).Inc()
+	}
+	s.drop(dropped)
+	spoolSize.WithLabelValues(s.sink).Set(float64(s.size))
+}
+
+// drop counts the dropped events, it never blocks.
+func (s *spool) drop(n int) {
+	if n <= 0 {
+		return
+	}
+	exportedEvents.WithLabelValues(s.sink, resultDropped).Add(float64(n))
+	atomic.AddUint64(&s.dropped, uint64(n))
+}
+
+// reportDropped logs the events dropped since the last report.
+func (s *spool) reportDropped() {
+	dropped := atomic.SwapUint64(&s.dropped, 0)
+	s.mu.Lock()
+	err := s.lastErr
+	s.lastErr = nil
+	s.mu.Unlock()
+	if dropped == 0 {
+		return
+	}
+	if err != nil {
+		logs.CtxError(context.Background(), "[Export] %d events of sink %s are dropped, the last spool error: %v", dropped, s.sink, err)
+		return
+	}
+	logs.CtxError(context.Background(), "[Export] %d events of sink %s are dropped, the buffer and the spool are full", dropped, s.sink)
+}
+
+func (s *spool) write(line []byte) error {
+	if s.file == nil {
+		// names are sortable by the creation time
+		path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", time.Now().UnixNano(), spoolFileSuffix))
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		s.file = file
+	}
+	_, err := s.file.Write(line)
+	return err
+}
+
+// seal closes the open file and returns the files to replay, oldest first.
+func (s *spool) seal() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+	files := make([]string, 0, len(s.sizes))
+	for file := range s.sizes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// remove deletes the replayed file.
+func (s *spool) remove(file string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		logs.CtxWarn(context.Background(), "[Export] remove spool file %s failed: %v", file, err)
+		return
+	}
+	s.size -= s.sizes[file]
+	delete(s.sizes, file)
+	spoolSize.WithLabelValues(s.sink).Set(float64(s.size))
+}
+
+func (s *spool) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// readSpoolFile reads the events of the file in batches, it stops at the first error returned by fn.
+func readSpoolFile(path string, batchSize int, fn func(batch []message) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+	batch := make([]message, 0, batchSize)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// a line may be truncated if the proxy crashed while spooling
+			logs.CtxWarn(context.Background(), "[Export] skip broken event in spool file %s: %v", path, err)
+			continue
+		}
+		body := append([]byte(nil), scanner.Bytes()...)
+		batch = append(batch, message{Type: event.Type, Time: event.Time, Body: body})
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = make([]message, 0, batchSize)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
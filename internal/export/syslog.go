@@ -0,0 +1,167 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+const (
+	defaultSyslogFacility = 16 // local0
+	defaultSyslogAppName  = "key-proxy"
+	syslogSeverityInfo    = 6
+	syslogDialTimeout     = 10 * time.Second
+	syslogWriteTimeout    = 10 * time.Second
+	syslogTimeFormat      = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// syslogSink sends each event as an RFC 5424 message. Over tcp and tls the messages are framed by octet counting
+// (RFC 6587), over udp each message is a datagram.
+type syslogSink struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	header    string // "<PRI>1 " is followed by the timestamp, then this header
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogSink(conf common.SyslogSink) (Sink, error) {
+	if conf.Address == "" {
+		return nil, errors.New("address is empty")
+	}
+	facility := conf.Facility
+	if facility == 0 {
+		facility = defaultSyslogFacility
+	}
+	if facility < 0 || facility > 23 {
+		return nil, fmt.Errorf("facility %d is out of range [0, 23]", facility)
+	}
+	appName := conf.AppName
+	if appName == "" {
+		appName = defaultSyslogAppName
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogSink{
+		network: conf.Network,
+		address: conf.Address,
+		header: fmt.Sprintf("<%d>1 %%s %s %s %d", facility*8+syslogSeverityInfo,
+			hostname, appName, os.Getpid()),
+	}
+	switch conf.Network {
+	case "udp", "tcp":
+		if conf.Tls.Enabled {
+			return nil, fmt.Errorf("tls is enabled, the network should be tls instead of %s", conf.Network)
+		}
+	case "tls":
+		if s.tlsConfig, err = tlsConfig(conf.Tls); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog network: %q, available networks are: [udp, tcp, tls]", conf.Network)
+	}
+	return s, nil
+}
+
+// format builds the message "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID - MSG", the type of the event is the MSGID.
+func (s *syslogSink) format(msg message) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(s.header) + len(msg.Body) + 64)
+	fmt.Fprintf(&buf, s.header, msg.Time.UTC().Format(syslogTimeFormat))
+	buf.WriteString(" " + msg.Type + " - ")
+	buf.Write(msg.Body)
+	return buf.Bytes()
+}
+
+func (s *syslogSink) Send(ctx context.Context, messages []message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	var frames bytes.Buffer
+	for _, msg := range messages {
+		formatted := s.format(msg)
+		if s.network == "udp" {
+			if err := s.write(formatted); err != nil {
+				return err
+			}
+			continue
+		}
+		frames.WriteString(strconv.Itoa(len(formatted)))
+		frames.WriteByte(' ')
+		frames.Write(formatted)
+	}
+	if frames.Len() == 0 {
+		return nil
+	}
+	return s.write(frames.Bytes())
+}
+
+// write drops the connection on errors, it is dialed again on the next send.
+func (s *syslogSink) write(b []byte) error {
+	_ = s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+	if _, err := s.conn.Write(b); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if s.network != "tls" {
+		return dialer.DialContext(ctx, s.network, s.address)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return nil, err
+	}
+	config := s.tlsConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(s.address)
+	}
+	tlsConn := tls.Client(conn, config)
+	_ = tlsConn.SetDeadline(time.Now().Add(syslogDialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
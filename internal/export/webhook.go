@@ -0,0 +1,111 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+const (
+	defaultWebhookTimeout = 10
+
+	TimestampHeader = "X-Key-Proxy-Timestamp"
+	SignatureHeader = "X-Key-Proxy-Signature"
+)
+
+// webhookSink posts each batch as a JSON array of the events. If the secret is set, the batch is signed in the
+// header "X-Key-Proxy-Signature: sha256=<hex of HMAC-SHA256(secret, timestamp + "." + body)>", where the timestamp
+// is the unix time in the header X-Key-Proxy-Timestamp, so that the receiver can verify it and reject the replays.
+type webhookSink struct {
+	url     string
+	secret  []byte
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhookSink(conf common.WebhookSink) (Sink, error) {
+	u, err := url.Parse(conf.Url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("the scheme of the url should be http or https")
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	return &webhookSink{
+		url:     conf.Url,
+		secret:  []byte(conf.Secret),
+		headers: conf.Headers,
+		client:  &http.Client{Timeout: time.Duration(timeout) * time.Second},
+	}, nil
+}
+
+// Sign returns the value of the signature header of the body sent at the timestamp.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *webhookSink) Send(ctx context.Context, messages []message) error {
+	var body bytes.Buffer
+	body.WriteByte('[')
+	for i, msg := range messages {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		body.Write(msg.Body)
+	}
+	body.WriteByte(']')
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(s.secret, timestamp, body.Bytes()))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/config"
+	"github.com/volcengine/key-proxy/internal/service"
+	"github.com/volcengine/key-proxy/internal/service/provider"
+)
+
+const (
+	defaultUpstreamTimeout  = 3
+	defaultUpstreamCacheTTL = 30
+	defaultSelfTestCacheTTL = 30
+)
+
+// Check is a single check of the readiness.
+type Check struct {
+	Name    string
+	Status  string
+	Message string `json:",omitempty"`
+}
+
+// Report is the body of the probes, the status is ok only if all the checks passed.
+type Report struct {
+	Status    string
+	Version   string                 `json:",omitempty"`
+	Checks    []Check                `json:",omitempty"`
+	Upstreams []provider.ProbeResult `json:",omitempty"`
+}
+
+func (r *Report) add(name string, err error) {
+	check := Check{Name: name, Status: provider.CheckOK}
+	if err != nil {
+		check.Status = provider.CheckFailed
+		check.Message = err.Error()
+		r.Status = provider.CheckFailed
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// public strips the report down to the status and the names of the checks, since the probes of the proxy port are
+// not authenticated. The messages and the upstream hosts are served by the admin API.
+func (r Report) public() Report {
+	public := Report{Status: r.Status}
+	for _, check := range r.Checks {
+		public.Checks = append(public.Checks, Check{Name: check.Name, Status: check.Status})
+	}
+	return public
+}
+
+func writeReport(c *gin.Context, report Report) {
+	status := http.StatusOK
+	if report.Status != provider.CheckOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Healthz tells the process is alive, it does not check the dependencies.
+func Healthz(c *gin.Context) {
+	writeReport(c, Report{Status: provider.CheckOK, Version: base.Version})
+}
+
+// upstreamCache keeps the results of probing the upstream hosts, so that the probes of the proxy do not send DNS
+// queries and open connections on every hit.
+type upstreamCache struct {
+	mu        sync.Mutex
+	endpoints []common.Endpoint
+	probedAt  time.Time
+	results   []provider.ProbeResult
+}
+
+// probe returns the cached results if they are younger than Health.UpstreamCacheTTL and the endpoints have not been
+// reloaded, or probes the upstream hosts again. The concurrent callers wait for the same probing.
+func (u *upstreamCache) probe(conf *common.Config) []provider.ProbeResult {
+	ttl := conf.Health.UpstreamCacheTTL
+	if ttl <= 0 {
+		ttl = defaultUpstreamCacheTTL
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if sameEndpoints(u.endpoints, conf.Endpoints) && time.Since(u.probedAt) < time.Duration(ttl)*time.Second {
+		return u.results
+	}
+	timeout := conf.Health.UpstreamTimeout
+	if timeout <= 0 {
+		timeout = defaultUpstreamTimeout
+	}
+	// the probing is shared, so it is not canceled with the request which started it
+	u.results = provider.ProbeUpstreams(context.Background(), conf.Endpoints, time.Duration(timeout)*time.Second)
+	u.endpoints, u.probedAt = conf.Endpoints, time.Now()
+	return u.results
+}
+
+// sameEndpoints reports whether the endpoints are of the same config, which are never modified once loaded.
+func sameEndpoints(a, b []common.Endpoint) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// selfTestCache keeps the results of the self test like upstreamCache, so that the probes do not sign and validate
+// the sample requests on every hit.
+type selfTestCache struct {
+	mu       sync.Mutex
+	service  provider.IProviderService
+	testedAt time.Time
+	results  []provider.SelfTestResult
+}
+
+// test returns the cached results if they are younger than Health.SelfTestCacheTTL and the providers have not been
+// reloaded, or runs the self test again.
+func (s *selfTestCache) test(conf *common.Config, service provider.IProviderService) []provider.SelfTestResult {
+	ttl := conf.Health.SelfTestCacheTTL
+	if ttl <= 0 {
+		ttl = defaultSelfTestCacheTTL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.service == service && time.Since(s.testedAt) < time.Duration(ttl)*time.Second {
+		return s.results
+	}
+	s.results = service.SelfTest(context.Background())
+	s.service, s.testedAt = service, time.Now()
+	return s.results
+}
+
+// Readiness checks whether the proxy can serve. It is shared by the probes of the proxy port and the admin API, so
+// that both reuse the cached results.
+type Readiness struct {
+	listening func() error
+	upstreams upstreamCache
+	selfTests selfTestCache
+}
+
+// NewReadiness creates the checks of the readiness. listening returns an error until all the listeners are up, or
+// once the proxy is shutting down.
+func NewReadiness(listening func() error) *Readiness {
+	return &Readiness{listening: listening}
+}
+
+// Report tells whether the proxy can serve: the config is loaded, the providers are initialized and the listeners
+// are up. The upstream hosts are also checked if Health.CheckUpstream is enabled, at most once per
+// Health.UpstreamCacheTTL. The report has the messages of the failed checks and the upstream hosts.
+func (r *Readiness) Report(ctx context.Context) Report {
+	report := Report{Status: provider.CheckOK, Version: base.Version}
+	conf := config.FromContext(ctx).Config
+	if !config.Loaded() {
+		report.add("config", fmt.Errorf("config is not loaded"))
+	} else {
+		report.add("config", nil)
+	}
+	if service.ProviderServiceFromContext(ctx) == nil {
+		report.add("providers", fmt.Errorf("providers are not initialized"))
+	} else {
+		report.add("providers", nil)
+	}
+	report.add("listeners", r.listening())
+	if conf.Health.CheckUpstream {
+		report.Upstreams = r.upstreams.probe(conf)
+		var failed int
+		for _, upstream := range report.Upstreams {
+			if upstream.Status != provider.CheckOK {
+				failed++
+			}
+		}
+		var err error
+		if failed > 0 {
+			err = fmt.Errorf("%d of %d upstream hosts are unreachable", failed, len(report.Upstreams))
+		}
+		report.add("upstreams", err)
+	}
+	return report
+}
+
+// Readyz serves the report with only the status and the names of the checks.
+func (r *Readiness) Readyz(c *gin.Context) {
+	writeReport(c, r.Report(c.Request.Context()).public())
+}
+
+// ReadyzDetails serves the whole report, for the admin API.
+func (r *Readiness) ReadyzDetails(c *gin.Context) {
+	writeReport(c, r.Report(c.Request.Context()))
+}
+
+// SelfTest serves the status of the self test, see provider.SelfTest. The results are reused for
+// Health.SelfTestCacheTTL, and they are not served since they reveal the cloud accounts and the proxy credentials.
+func (r *Readiness) SelfTest(c *gin.Context) {
+	ctx := c.Request.Context()
+	providerService := service.ProviderServiceFromContext(ctx)
+	if providerService == nil {
+		writeReport(c, Report{Status: provider.CheckFailed})
+		return
+	}
+	report := Report{Status: provider.CheckOK}
+	for _, result := range r.selfTests.test(config.FromContext(ctx).Config, providerService) {
+		if result.Status == provider.CheckFailed {
+			report.Status = provider.CheckFailed
+		}
+	}
+	writeReport(c, report)
+}
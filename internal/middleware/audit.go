@@ -0,0 +1,61 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/volcengine/key-proxy/internal/audit"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/export"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+var auditWriteErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "key_proxy_audit_write_errors_total",
+	Help: "Audit records which could not be written.",
+})
+
+// Audit writes an audit record for each proxied request and exports it. Like Metrics, it must be placed before
+// ExceptionGuard.
+func Audit(writer *audit.Writer, exporter *export.Exporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.FullPath() != "" {
+			return
+		}
+		mcdnArgs := base.GetMcdnArgs(c)
+		state := base.GetRequestState(c.Request.Context())
+		record := audit.Record{
+			Time:             mcdnArgs.RequestTime,
+			RequestId:        mcdnArgs.RequestId,
+			ClientIP:         mcdnArgs.ClientIP,
+			CloudAccountName: mcdnArgs.CloudAccountName,
+			Vendor:           base.ResolveVendor(c.Request.Context(), mcdnArgs),
+			Operation:        state.Operation(),
+			ProxyCredential:  state.ProxyCredential(),
+			ProxyAccessKey:   state.ProxyAccessKey(),
+			Decision:         audit.DecisionRejected,
+			ExceptionCode:    c.GetString(base.ProxyExceptionTextCodeKey),
+			ShadowViolations: state.ShadowViolations(),
+			HttpStatus:       c.Writer.Status(),
+			UpstreamStatus:   state.UpstreamStatus(),
+		}
+		// the request is forwarded once it is resigned or the vendor responded, even if the response failed later
+		if state.Resigned() || record.UpstreamStatus != 0 {
+			record.Decision = audit.DecisionForwarded
+		}
+		line, err := writer.Write(record)
+		if err != nil {
+			auditWriteErrors.Inc()
+			logs.CtxError(c.Request.Context(), "[Audit] write audit record failed: %v", err)
+			return
+		}
+		exporter.Export(export.EventAudit, line)
+	}
+}
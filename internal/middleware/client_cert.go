@@ -0,0 +1,85 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package middleware
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/config"
+)
+
+// ClientCertBinding checks that the verified client certificate is bound to the requested cloud account. Once
+// bindings are configured, requests without a verified client certificate are rejected, including those from the
+// listeners without TLS, so the bindings cannot be bypassed.
+func ClientCertBinding() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bindings := config.FromContext(c.Request.Context()).Config.Http.Tls.ClientAuth.Bindings
+		if len(bindings) == 0 {
+			c.Next()
+			return
+		}
+		state := c.Request.TLS
+		if state == nil || len(state.VerifiedChains) == 0 {
+			panic(base.ClientCertForbidden.WithRawError(fmt.Errorf("a verified client certificate is required by the bindings")))
+		}
+		cert := state.VerifiedChains[0][0]
+		mcdnArgs := base.GetMcdnArgs(c)
+		identities := certIdentities(cert)
+		matched := false
+		for _, binding := range bindings {
+			if binding.Subject != "*" && !contains(identities, binding.Subject) {
+				continue
+			}
+			matched = true
+			if bindingAllows(binding, mcdnArgs) {
+				c.Next()
+				return
+			}
+		}
+		if !matched {
+			panic(base.ClientCertForbidden.WithRawError(fmt.Errorf("client certificate %s is not bound to any cloud account", cert.Subject.CommonName)))
+		}
+		panic(base.ClientCertForbidden.WithRawError(fmt.Errorf("client certificate %s is not allowed to access cloud account %s (top account id: %s)",
+			cert.Subject.CommonName, mcdnArgs.CloudAccountName, mcdnArgs.TopAccountId)))
+	}
+}
+
+func certIdentities(cert *x509.Certificate) []string {
+	identities := make([]string, 0, 1+len(cert.DNSNames)+len(cert.URIs)+len(cert.EmailAddresses))
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, cert.EmailAddresses...)
+	return identities
+}
+
+func bindingAllows(binding common.ClientBinding, mcdnArgs base.McdnArgs) bool {
+	if len(binding.CloudAccountNames) > 0 && !contains(binding.CloudAccountNames, mcdnArgs.CloudAccountName) {
+		return false
+	}
+	if len(binding.TopAccountIds) > 0 && !contains(binding.TopAccountIds, mcdnArgs.TopAccountId) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, target string) bool {
+	for _, value := range values {
+		if value == "*" || value == target {
+			return true
+		}
+	}
+	return false
+}
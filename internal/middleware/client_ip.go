@@ -0,0 +1,42 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/config"
+	"github.com/volcengine/key-proxy/internal/utils"
+)
+
+// ClientIPGuard rejects the clients out of the allowed CIDRs of the proxy and of the requested cloud account.
+func ClientIPGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshot := config.FromContext(c.Request.Context())
+		mcdnArgs := base.GetMcdnArgs(c)
+		ctx := c.Request.Context()
+		mode := base.RuleMode(snapshot.Config.Forbidden.ClientIP, false, base.ModeEnforce)
+		if err := checkClientIP(mcdnArgs.ClientIP, snapshot.AllowedCIDRs); err != nil {
+			base.Enforce(ctx, mode, base.ClientIPForbidden.WithRawError(fmt.Errorf("proxy: %v", err)))
+		}
+		if allowed, found := snapshot.AccountCIDRs[mcdnArgs.CloudAccountName]; found {
+			if err := checkClientIP(mcdnArgs.ClientIP, allowed); err != nil {
+				base.Enforce(ctx, mode, base.ClientIPForbidden.WithRawError(fmt.Errorf("cloud account %s: %v", mcdnArgs.CloudAccountName, err)))
+			}
+		}
+		c.Next()
+	}
+}
+
+func checkClientIP(clientIP string, allowed utils.IPList) error {
+	if allowed.Empty() || allowed.Contains(clientIP) {
+		return nil
+	}
+	return fmt.Errorf("client ip %s is not allowed", clientIP)
+}
@@ -21,7 +21,7 @@ func ExceptionGuard(onResponse common.OnResponse) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if panicData := recover(); panicData != nil {
-				logs.CtxError(c.Request.Context(), "capture an error: %v", panicData)
+				logs.CtxError(c.Request.Context(), "capture an error: %s", base.RedactText(fmt.Sprint(panicData)))
 				mcdnArgs := base.GetMcdnArgs(c)
 				var exception base.Exception
 				if e, ok := panicData.(base.Exception); ok {
@@ -32,9 +32,13 @@ func ExceptionGuard(onResponse common.OnResponse) gin.HandlerFunc {
 				c.Set(base.ProxyExceptionTextCodeKey, exception.Code)
 				c.Set(base.ProxyExceptionKey, true)
 				errResponse := base.BuildErrorResponse(mcdnArgs, exception)
-				if errResponse.ResponseMetadata.Error != nil {
+				// the errors in the format of the vendor must not reveal the proxy
+				if errResponse.ResponseMetadata.Error != nil && exception.Response == nil {
 					c.Header(base.ProxyStatusKey, base.ProxyStatusFailed)
 				}
+				if exception.Response != nil {
+					errResponse.ResponseMetadata.StatusCode = exception.Response.StatusCode
+				}
 				responseTime := time.Now()
 				baseInfo := base.GetBaseInfo(c)
 				onResponse(c.Request.Context(), common.ResponseInfo{
@@ -44,8 +48,15 @@ func ExceptionGuard(onResponse common.OnResponse) gin.HandlerFunc {
 					HttpStatus:             errResponse.ResponseMetadata.StatusCode,
 					ProxyException:         c.GetBool(base.ProxyExceptionKey),
 					ProxyExceptionTextCode: c.GetString(base.ProxyExceptionTextCodeKey),
+					ShadowViolations:       base.GetRequestState(c.Request.Context()).ShadowViolations(),
+					ProxyCredential:        base.GetRequestState(c.Request.Context()).ProxyCredential(),
 				})
-				c.JSON(errResponse.ResponseMetadata.StatusCode, errResponse)
+				if exception.Response != nil {
+					c.Data(exception.Response.StatusCode, exception.Response.ContentType, exception.Response.Body)
+					c.Abort()
+					return
+				}
+				c.AbortWithStatusJSON(errResponse.ResponseMetadata.StatusCode, errResponse)
 			}
 		}()
 		c.Next()
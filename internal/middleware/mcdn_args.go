@@ -8,15 +8,32 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/volcengine/key-proxy/common"
 	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/config"
 )
 
 // SetMcdnArgs get necessary parameters from the platform and then store them into gin context
 func SetMcdnArgs() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// the config and the providers are read once, so that reloading does not affect the requests in flight
+		ctx := config.WithSnapshot(c.Request.Context(), config.Current())
+		ctx, state := base.WithRequestState(ctx)
+		c.Request = c.Request.WithContext(ctx)
 		mcdnArgs := base.NewMcdnArgs(c)
 		c.Set(base.McdnArgsKey, mcdnArgs)
-		c.Set(base.BaseInfoKey, base.NewBaseInfo(c, mcdnArgs))
+		// the logs emitted while handling the request carry these fields
+		c.Request = c.Request.WithContext(common.WithLogFields(ctx,
+			common.LogField{Key: "request_id", Value: mcdnArgs.RequestId},
+			common.LogField{Key: "cloud_account", Value: mcdnArgs.CloudAccountName},
+			common.LogField{Key: "vendor", Value: base.ResolveVendor(ctx, mcdnArgs)},
+			common.LogField{Key: "client_ip", Value: mcdnArgs.ClientIP},
+		))
+		state.BaseInfo = base.NewBaseInfo(c, mcdnArgs)
+		// the target url is exported, the request is redacted by the hooks which dump it
+		info := state.BaseInfo
+		info.TargetUrl = base.RedactRawURL(info.TargetUrl)
+		c.Set(base.BaseInfoKey, info)
 		c.Next()
 	}
 }
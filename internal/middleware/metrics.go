@@ -0,0 +1,64 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/metrics"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "key_proxy_requests_total",
+		Help: "Requests proxied to the cloud vendors.",
+	}, []string{"vendor", "cloud_account", "status", "exception"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "key_proxy_request_duration_seconds",
+		Help:    "Total latency of the proxied requests, including the upstream latency.",
+		Buckets: metrics.DurationBuckets,
+	}, []string{"vendor", "cloud_account", "status", "exception"})
+	requestSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "key_proxy_request_size_bytes",
+		Help:    "Body sizes of the proxied requests.",
+		Buckets: metrics.SizeBuckets,
+	}, []string{"vendor", "cloud_account"})
+	responseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "key_proxy_response_size_bytes",
+		Help:    "Body sizes of the responses of the proxied requests.",
+		Buckets: metrics.SizeBuckets,
+	}, []string{"vendor", "cloud_account"})
+)
+
+// Metrics records the proxied requests. It must be placed before ExceptionGuard, so that the exceptions have been
+// handled when the request is recorded.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		// requests served by the routes of the proxy itself, such as /ping, are not recorded
+		if c.FullPath() != "" {
+			return
+		}
+		mcdnArgs := base.GetMcdnArgs(c)
+		vendor, cloudAccount := base.MetricLabels(c.Request.Context(), mcdnArgs.CloudAccountName)
+		status := strconv.Itoa(c.Writer.Status())
+		exception := c.GetString(base.ProxyExceptionTextCodeKey)
+		requestsTotal.WithLabelValues(vendor, cloudAccount, status, exception).Inc()
+		requestDuration.WithLabelValues(vendor, cloudAccount, status, exception).Observe(time.Since(mcdnArgs.RequestTime).Seconds())
+		if c.Request.ContentLength >= 0 {
+			requestSize.WithLabelValues(vendor, cloudAccount).Observe(float64(c.Request.ContentLength))
+		}
+		if size := c.Writer.Size(); size >= 0 {
+			responseSize.WithLabelValues(vendor, cloudAccount).Observe(float64(size))
+		}
+	}
+}
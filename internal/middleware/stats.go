@@ -0,0 +1,43 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/volcengine/key-proxy/internal/admin"
+	"github.com/volcengine/key-proxy/internal/base"
+)
+
+// Stats records the proxied requests for the admin API. Like Metrics, it must be placed before ExceptionGuard.
+func Stats(recorder *admin.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.FullPath() != "" {
+			return
+		}
+		mcdnArgs := base.GetMcdnArgs(c)
+		state := base.GetRequestState(c.Request.Context())
+		_, account := base.MetricLabels(c.Request.Context(), mcdnArgs.CloudAccountName)
+		recorder.Record(account, admin.Request{
+			Time:             mcdnArgs.RequestTime,
+			RequestId:        mcdnArgs.RequestId,
+			ClientIP:         mcdnArgs.ClientIP,
+			CloudAccountName: mcdnArgs.CloudAccountName,
+			Vendor:           base.ResolveVendor(c.Request.Context(), mcdnArgs),
+			Operation:        state.Operation(),
+			ProxyCredential:  state.ProxyCredential(),
+			TargetUrl:        base.RedactRawURL(c.GetHeader(base.OriginUrlKey)),
+			ExceptionCode:    c.GetString(base.ProxyExceptionTextCodeKey),
+			ShadowViolations: state.ShadowViolations(),
+			HttpStatus:       c.Writer.Status(),
+			UpstreamStatus:   state.UpstreamStatus(),
+			Cost:             time.Since(mcdnArgs.RequestTime),
+		})
+	}
+}
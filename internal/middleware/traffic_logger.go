@@ -8,18 +8,23 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/volcengine/key-proxy/common"
 	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/export"
+	"github.com/volcengine/key-proxy/internal/tracing"
 	"github.com/volcengine/key-proxy/internal/utils/logs"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
 // StandardOnRequest is the standard onRequest hook.
 func StandardOnRequest(ctx context.Context, requestInfo common.RequestInfo) {
 	reqLog := base.DumpHttpRequest(requestInfo.Request)
-	logs.CtxInfo(ctx, "[TrafficLogger] http request @%s, vendor: %s, cloud account id: %s, cloud account name: %s \n%s",
+	logs.CtxInfo(ctx, "[TrafficLogger] http request @%s, client ip: %s, vendor: %s, cloud account id: %s, cloud account name: %s \n%s",
 		requestInfo.RequestTime.String(),
+		requestInfo.ClientIP,
 		requestInfo.VendorName,
 		requestInfo.CloudAccountId,
 		requestInfo.CloudAccountName,
@@ -29,34 +34,61 @@ func StandardOnRequest(ctx context.Context, requestInfo common.RequestInfo) {
 
 // StandardOnResponse is the standard onResponse hook.
 func StandardOnResponse(ctx context.Context, response common.ResponseInfo) {
-	logs.CtxInfo(ctx, "[TrafficLogger] http response @%s, cost: %dms, status: %d",
+	logs.CtxInfo(ctx, "[TrafficLogger] http response @%s, cost: %dms, status: %d, proxy credential: %s, exception: %s, shadow violations: %v",
 		response.ResponseTime.String(),
 		response.Cost.Milliseconds(),
 		response.HttpStatus,
+		response.ProxyCredential,
+		response.ProxyExceptionTextCode,
+		response.ShadowViolations,
 	)
 }
 
-// TrafficLogger gets the data before and after the request is processed and pass the data into the hook functions.
-func TrafficLogger(onRequest common.OnRequest, onResponse common.OnResponse) gin.HandlerFunc {
+// TrafficLogger gets the data before and after the request is processed and pass the data into the hook functions,
+// then exports them. The exporter may be nil.
+func TrafficLogger(onRequest common.OnRequest, onResponse common.OnResponse, exporter *export.Exporter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		mcdnArgs := base.GetMcdnArgs(c)
 		commonInfo := base.GetBaseInfo(c)
-		onRequest(c.Request.Context(), common.RequestInfo{
+		// the request is traced as a child of the span of the platform, if traceparent is given
+		ctx, span := tracing.Start(tracing.Extract(c.Request.Context(), c.Request.Header), "key-proxy "+c.Request.Method, tracing.SpanKindServer)
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			ctx = common.WithLogFields(ctx, common.LogField{Key: "trace_id", Value: spanContext.TraceID().String()})
+		}
+		c.Request = c.Request.WithContext(ctx)
+		span.SetAttribute("http.request.method", c.Request.Method)
+		span.SetAttribute("mcdn.request_id", mcdnArgs.RequestId)
+		span.SetAttribute("mcdn.vendor", mcdnArgs.VendorName)
+		span.SetAttribute("mcdn.cloud_account", mcdnArgs.CloudAccountName)
+		span.SetAttribute("client.address", mcdnArgs.ClientIP)
+		requestInfo := common.RequestInfo{
 			BaseInfo:    commonInfo,
 			RequestTime: mcdnArgs.RequestTime,
-		})
+		}
+		onRequest(c.Request.Context(), requestInfo)
+		exporter.Export(export.EventRequest, requestInfo)
 		c.Header(base.ProxyVersionKey, base.Version)
 		c.Next()
 		// the response has been sent over here
 		responseTime := time.Now()
-		onResponse(c.Request.Context(), common.ResponseInfo{
+		span.SetIntAttribute("http.response.status_code", c.Writer.Status())
+		if exceptionCode := c.GetString(base.ProxyExceptionTextCodeKey); exceptionCode != "" {
+			span.SetAttribute("key_proxy.exception", exceptionCode)
+			span.SetError(errors.New(exceptionCode))
+		}
+		span.End()
+		responseInfo := common.ResponseInfo{
 			BaseInfo:               commonInfo,
 			ResponseTime:           responseTime,
 			Cost:                   responseTime.Sub(mcdnArgs.RequestTime),
 			HttpStatus:             c.Writer.Status(),
 			ProxyException:         c.GetBool(base.ProxyExceptionKey),
 			ProxyExceptionTextCode: c.GetString(base.ProxyExceptionTextCodeKey),
-		})
+			ShadowViolations:       base.GetRequestState(c.Request.Context()).ShadowViolations(),
+			ProxyCredential:        base.GetRequestState(c.Request.Context()).ProxyCredential(),
+		}
+		onResponse(c.Request.Context(), responseInfo)
+		exporter.Export(export.EventResponse, responseInfo)
 		return
 	}
 }
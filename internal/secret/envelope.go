@@ -0,0 +1,129 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// EnvelopePrefix marks a config value encrypted with AES-256-GCM by the master key.
+	EnvelopePrefix = "enc:v1:"
+	// MasterKeyEnv holds the base64 (or hex) encoded master key.
+	MasterKeyEnv = "KEY_PROXY_MASTER_KEY"
+	// MasterKeyFileEnv holds the path of the file containing the master key.
+	MasterKeyFileEnv = "KEY_PROXY_MASTER_KEY_FILE"
+
+	masterKeySize = 32
+)
+
+// IsEncrypted reports whether the value is an encrypted envelope.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EnvelopePrefix)
+}
+
+// GenerateMasterKey generates a random master key encoded in base64.
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, masterKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadMasterKey loads the master key from the file, or from the environment variables if the file is empty.
+// It returns nil without error if no master key is configured.
+func LoadMasterKey(file string) ([]byte, error) {
+	if file == "" {
+		file = os.Getenv(MasterKeyFileEnv)
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read master key file failed: %v", err)
+		}
+		return ParseMasterKey(data)
+	}
+	if value := os.Getenv(MasterKeyEnv); value != "" {
+		return ParseMasterKey([]byte(value))
+	}
+	return nil, nil
+}
+
+// ParseMasterKey parses a 32 bytes master key encoded in base64, hex or raw bytes.
+func ParseMasterKey(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if key, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil && len(key) == masterKeySize {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(string(trimmed)); err == nil && len(key) == masterKeySize {
+		return key, nil
+	}
+	if len(data) == masterKeySize {
+		return data, nil
+	}
+	return nil, fmt.Errorf("master key must be %d bytes, encoded in base64 or hex", masterKeySize)
+}
+
+// Encrypt encrypts the plaintext into an envelope like "enc:v1:<base64(nonce|ciphertext)>".
+func Encrypt(masterKey []byte, plaintext string) (string, error) {
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(EnvelopePrefix))
+	return EnvelopePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts the envelope produced by Encrypt, values without the envelope prefix are returned as they are.
+func Decrypt(masterKey []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EnvelopePrefix))
+	if err != nil {
+		return "", fmt.Errorf("decode envelope failed: %v", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("envelope is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(EnvelopePrefix))
+	if err != nil {
+		return "", fmt.Errorf("decrypt envelope failed, the master key may be wrong: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+func newAEAD(masterKey []byte) (cipher.AEAD, error) {
+	if len(masterKey) != masterKeySize {
+		return nil, errors.New("master key is not configured or its size is wrong")
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package secret
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+const (
+	filePrefix  = "file://"
+	execPrefix  = "exec:"
+	vaultPrefix = "vault:"
+
+	vaultAddrEnv  = "VAULT_ADDR"
+	vaultTokenEnv = "VAULT_TOKEN"
+
+	defaultSourceTimeout = 10 * time.Second
+)
+
+var envRe = regexp.MustCompile(`^\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// Resolver resolves credential values which reference external secret sources:
+//
+//	${env:VOLC_SK}                        environment variable
+//	file:///run/secrets/volc_sk           content of the file
+//	exec:/usr/local/bin/get-secret volc   stdout of the command, arguments are split by spaces
+//	vault:secret/data/key-proxy#volc_sk   field of a Vault compatible KV secret
+//
+// Other values are returned as they are.
+type Resolver struct {
+	vault      common.Vault
+	httpClient *http.Client
+}
+
+func NewResolver(conf common.Secrets) *Resolver {
+	return &Resolver{
+		vault:      conf.Vault,
+		httpClient: &http.Client{Timeout: defaultSourceTimeout},
+	}
+}
+
+// ResolveCredentials resolves all fields of the proxy and real credentials.
+func (r *Resolver) ResolveCredentials(ctx context.Context, credentials common.Credentials) (common.Credentials, error) {
+	var err error
+	if credentials.Proxy, err = r.ResolveCredential(ctx, credentials.Proxy); err != nil {
+		return credentials, fmt.Errorf("resolve proxy credential failed: %v", err)
+	}
+	proxies := make([]common.ProxyCredential, len(credentials.Proxies))
+	for i, proxy := range credentials.Proxies {
+		if proxy.Credential, err = r.ResolveCredential(ctx, proxy.Credential); err != nil {
+			return credentials, fmt.Errorf("resolve proxy credential %d failed: %v", i, err)
+		}
+		proxies[i] = proxy
+	}
+	credentials.Proxies = proxies
+	if credentials.Real, err = r.ResolveCredential(ctx, credentials.Real); err != nil {
+		return credentials, fmt.Errorf("resolve real credential failed: %v", err)
+	}
+	return credentials, nil
+}
+
+func (r *Resolver) ResolveCredential(ctx context.Context, cre common.Credential) (common.Credential, error) {
+	for _, value := range []*string{&cre.AccessKey, &cre.SecretKey, &cre.AccessToken, &cre.ClientToken, &cre.ClientSecret} {
+		resolved, err := r.Resolve(ctx, *value)
+		if err != nil {
+			return cre, err
+		}
+		*value = resolved
+	}
+	return cre, nil
+}
+
+// Resolve resolves a single value.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	if matches := envRe.FindStringSubmatch(value); len(matches) == 2 {
+		resolved, found := os.LookupEnv(matches[1])
+		if !found {
+			return "", fmt.Errorf("environment variable %s is not set", matches[1])
+		}
+		return resolved, nil
+	}
+	switch {
+	case strings.HasPrefix(value, filePrefix):
+		return r.resolveFile(strings.TrimPrefix(value, filePrefix))
+	case strings.HasPrefix(value, execPrefix):
+		return r.resolveExec(ctx, strings.TrimPrefix(value, execPrefix))
+	case strings.HasPrefix(value, vaultPrefix):
+		return r.resolveVault(ctx, strings.TrimPrefix(value, vaultPrefix))
+	}
+	return value, nil
+}
+
+func (r *Resolver) resolveFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file failed: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (r *Resolver) resolveExec(ctx context.Context, command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", errors.New("exec command is empty")
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultSourceTimeout)
+	defer cancel()
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	// stderr is discarded and only the exit status is reported, since the helpers may echo the secrets or the
+	// tokens on failure, and the error ends up in the logs
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("exec %s failed: %v", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// resolveVault reads "path#field" from the KV secrets engine, both KV v1 and v2 responses are supported.
+func (r *Resolver) resolveVault(ctx context.Context, ref string) (string, error) {
+	items := strings.SplitN(ref, "#", 2)
+	if len(items) != 2 || items[0] == "" || items[1] == "" {
+		return "", fmt.Errorf("vault reference must be like \"vault:<path>#<field>\"")
+	}
+	path, field := strings.Trim(items[0], "/"), items[1]
+	address := r.vault.Address
+	if address == "" {
+		address = os.Getenv(vaultAddrEnv)
+	}
+	if address == "" {
+		return "", errors.New("vault address is not configured")
+	}
+	token, err := r.vaultToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(address, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if r.vault.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.vault.Namespace)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request vault failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request vault failed, path: %s, status: %d", path, resp.StatusCode)
+	}
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("parse vault response failed: %v", err)
+	}
+	data := result.Data
+	// KV v2 wraps the secret into another "data" with "metadata" aside
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = inner
+		}
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("field %s is not found in vault secret %s", field, path)
+	}
+	return value, nil
+}
+
+func (r *Resolver) vaultToken(ctx context.Context) (string, error) {
+	if r.vault.TokenFile != "" {
+		return r.resolveFile(r.vault.TokenFile)
+	}
+	if r.vault.Token != "" {
+		// the token itself may reference an environment variable or a file
+		if strings.HasPrefix(r.vault.Token, vaultPrefix) {
+			return "", errors.New("vault token cannot reference vault")
+		}
+		return r.Resolve(ctx, r.vault.Token)
+	}
+	if token := os.Getenv(vaultTokenEnv); token != "" {
+		return token, nil
+	}
+	return "", errors.New("vault token is not configured")
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AccountInfo describes a configured cloud account without any secret.
+type AccountInfo struct {
+	CloudAccountName string
+	Vendor           string
+	ReadOnly         bool
+	ProxyCredentials []ProxyCredentialInfo
+	Disabled         *DisabledAccount `json:",omitempty"`
+}
+
+// ProxyCredentialInfo identifies a proxy credential by its access key, or by the client token of akamai.
+type ProxyCredentialInfo struct {
+	Name      string
+	AccessKey string
+	NotAfter  *time.Time `json:",omitempty"`
+}
+
+// DisabledAccount is a cloud account disabled by the administrator, until the time if it is not nil.
+type DisabledAccount struct {
+	Since  time.Time
+	Until  *time.Time `json:",omitempty"`
+	Reason string     `json:",omitempty"`
+}
+
+func (d DisabledAccount) active(now time.Time) bool {
+	return d.Until == nil || now.Before(*d.Until)
+}
+
+// disabledAccounts keeps the accounts disabled at runtime. It is shared by the provider services, so the accounts
+// stay disabled after reloading, until they are enabled, their time is up or the proxy restarts.
+type disabledAccounts struct {
+	mu       sync.RWMutex
+	accounts map[string]DisabledAccount
+}
+
+var sharedDisabledAccounts = &disabledAccounts{accounts: make(map[string]DisabledAccount)}
+
+func (d *disabledAccounts) get(name string, now time.Time) (DisabledAccount, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	disabled, found := d.accounts[name]
+	if !found || !disabled.active(now) {
+		return DisabledAccount{}, false
+	}
+	return disabled, true
+}
+
+func (d *disabledAccounts) set(name string, disabled DisabledAccount) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.accounts[name] = disabled
+}
+
+func (d *disabledAccounts) remove(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	disabled, found := d.accounts[name]
+	delete(d.accounts, name)
+	return found && disabled.active(time.Now())
+}
+
+// Accounts lists the cloud accounts sorted by their names.
+func (s *ImplProviderService) Accounts() []AccountInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	accounts := make([]AccountInfo, 0, len(s.endpointProviders))
+	for name, provider := range s.endpointProviders {
+		account := AccountInfo{
+			CloudAccountName: name,
+			Vendor:           provider.endpoint.Vendor,
+			ReadOnly:         provider.endpoint.ReadOnly,
+		}
+		for _, candidate := range provider.candidates {
+			accessKey := candidate.credential.AccessKey
+			if accessKey == "" {
+				accessKey = candidate.credential.ClientToken
+			}
+			info := ProxyCredentialInfo{Name: candidate.name, AccessKey: accessKey}
+			if !candidate.notAfter.IsZero() {
+				notAfter := candidate.notAfter
+				info.NotAfter = &notAfter
+			}
+			account.ProxyCredentials = append(account.ProxyCredentials, info)
+		}
+		if disabled, found := sharedDisabledAccounts.get(name, now); found {
+			account.Disabled = &disabled
+		}
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].CloudAccountName < accounts[j].CloudAccountName
+	})
+	return accounts
+}
+
+// DisableAccount rejects the requests to the cloud account until the time, or until it is enabled if until is zero.
+func (s *ImplProviderService) DisableAccount(name string, until time.Time, reason string) error {
+	if _, found := s.getEndpointProvider(name); !found {
+		return fmt.Errorf("cloud account %s is not found", name)
+	}
+	disabled := DisabledAccount{Since: time.Now(), Reason: reason}
+	if !until.IsZero() {
+		disabled.Until = &until
+	}
+	sharedDisabledAccounts.set(name, disabled)
+	return nil
+}
+
+// EnableAccount enables the disabled cloud account, it reports whether the account was disabled.
+func (s *ImplProviderService) EnableAccount(name string) bool {
+	return sharedDisabledAccounts.remove(name)
+}
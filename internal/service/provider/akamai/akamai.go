@@ -9,10 +9,14 @@ package akamai
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
 	"regexp"
+	"strings"
+	"time"
 )
 
 const (
@@ -20,6 +24,7 @@ const (
 	akamaiTimestampKey = "AkamaiTimestamp"
 	akamaiNonceKey     = "AkamaiNonce"
 	vendorName         = "akamai"
+	timestampFormat    = "20060102T15:04:05-0700"
 )
 
 var timestampNonceRe = regexp.MustCompile(`timestamp=(.*?);nonce=(.*?);`)
@@ -28,6 +33,10 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &akamaiProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.akamaiapis.net")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{Headers: []string{"Authorization"}})
 }
 
 type akamaiProvider struct {
@@ -48,6 +57,9 @@ func (s *akamaiProvider) ValidateRequest(ctx context.Context, req *http.Request)
 	computedSign := createAuthHeader(req, cre.ClientToken, cre.AccessToken, cre.ClientSecret, matches[1], matches[2])
 	ctx = context.WithValue(ctx, akamaiTimestampKey, matches[1])
 	ctx = context.WithValue(ctx, akamaiNonceKey, matches[2])
+	if signTime, err := time.Parse(timestampFormat, matches[1]); err == nil {
+		ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Nonce: matches[2], Signature: requestSign})
+	}
 	return ctx, computedSign == requestSign, nil
 }
 
@@ -58,3 +70,42 @@ func (s *akamaiProvider) ResignRequest(ctx context.Context, req *http.Request) e
 	req.Header.Set(signatureKey, createAuthHeader(req, cre.ClientToken, cre.AccessToken, cre.ClientSecret, timestamp, nonce))
 	return nil
 }
+
+// Operation takes the first segment of the path as the service, e.g. "papi" or "ccu".
+func (s *akamaiProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	service := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)[0]
+	return provider.RestOperation(service, req)
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *akamaiProvider) ProxyAccessKey(req *http.Request) string {
+	return provider.AuthorizationField(req.Header.Get(signatureKey), "client_token", ";")
+}
+
+// sampleRequest carries the client token and the access token, the hosts of akamai are specific to the accounts.
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://akab-key-proxy-selftest.luna.akamaiapis.net/papi/v1/groups", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(signatureKey, fmt.Sprintf("EG1-HMAC-SHA256 client_token=%s;access_token=%s;timestamp=%s;nonce=key-proxy-selftest;signature=",
+		credential.ClientToken, credential.AccessToken, now.UTC().Format(timestampFormat)))
+	return req, nil
+}
+
+// quarantineResponse renders the problem details of the authentication of Akamai.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	detail := "The signature does not match"
+	if reason == provider.QuarantineInvalidAccessKey {
+		detail = "Invalid authorization client_token"
+	}
+	response := provider.JSONResponse(http.StatusUnauthorized, map[string]interface{}{
+		"type":     "https://problems.luna.akamaiapis.net/-/pep-authn/deny",
+		"title":    "Not authorized",
+		"status":   http.StatusUnauthorized,
+		"detail":   detail,
+		"instance": "https://akab.luna.akamaiapis.net/-/errors/" + requestId,
+	})
+	response.ContentType = "application/problem+json"
+	return response
+}
@@ -18,18 +18,33 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"time"
 )
 
 const (
-	aliyunSignatureKey   = "Signature"
-	aliyunAccessKeIdyKey = "AccessKeyId"
-	vendorName           = "aliyun"
+	aliyunSignatureKey      = "Signature"
+	aliyunAccessKeIdyKey    = "AccessKeyId"
+	aliyunTimestampKey      = "Timestamp"
+	aliyunSignatureNonceKey = "SignatureNonce"
+	aliyunSecurityTokenKey  = "SecurityToken"
+	aliyunTimestampFormat   = "2006-01-02T15:04:05Z"
+	vendorName              = "aliyun"
 )
 
 func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &aliyunProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.aliyuncs.com")
+	provider.RegisterProbeHosts(vendorName, "cdn.aliyuncs.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{
+		Headers:    []string{"Authorization", "X-Acs-Security-Token"},
+		Query:      []string{aliyunSignatureKey, aliyunSecurityTokenKey},
+		BodyFields: []string{aliyunSignatureKey, aliyunSecurityTokenKey},
+	})
+	provider.RegisterRoleAssumer(vendorName, assumeRole)
 }
 
 type aliyunProvider struct {
@@ -46,6 +61,9 @@ func (s *aliyunProvider) ValidateRequest(ctx context.Context, req *http.Request)
 	requestSign := q.Get(aliyunSignatureKey)
 	q.Del(aliyunSignatureKey)
 	req.URL.RawQuery = base.QuickEncode(q)
+	if signTime, err := time.Parse(aliyunTimestampFormat, q.Get(aliyunTimestampKey)); err == nil {
+		ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Nonce: q.Get(aliyunSignatureNonceKey), Signature: requestSign})
+	}
 	computedSign := s.sign(req.Method, q, s.Credentials.Proxy.SecretKey)
 	return ctx, computedSign == requestSign, nil
 }
@@ -53,6 +71,9 @@ func (s *aliyunProvider) ValidateRequest(ctx context.Context, req *http.Request)
 func (s *aliyunProvider) ResignRequest(ctx context.Context, req *http.Request) error {
 	q := req.URL.Query()
 	q.Set(aliyunAccessKeIdyKey, s.Credentials.Real.AccessKey)
+	if s.Credentials.Real.AccessToken != "" {
+		q.Set(aliyunSecurityTokenKey, s.Credentials.Real.AccessToken)
+	}
 	q.Set(aliyunSignatureKey, s.sign(req.Method, q, s.Credentials.Real.SecretKey))
 	req.URL.RawQuery = base.QuickEncode(q)
 	return nil
@@ -97,3 +118,37 @@ func percentEncode(s string) string {
 	v = strings.ReplaceAll(v, "%7E", "~")
 	return v
 }
+
+func (s *aliyunProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	q := req.URL.Query()
+	return provider.Operation{Service: provider.HostService(req.URL.Hostname()), Action: q.Get("Action"), Region: q.Get("RegionId")}
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *aliyunProvider) ProxyAccessKey(req *http.Request) string {
+	return req.URL.Query().Get(aliyunAccessKeIdyKey)
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	q := url.Values{}
+	q.Set("Action", "DescribeUserDomains")
+	q.Set("Format", "JSON")
+	q.Set("Version", "2018-05-10")
+	q.Set("SignatureMethod", "HMAC-SHA1")
+	q.Set("SignatureVersion", "1.0")
+	q.Set(aliyunSignatureNonceKey, "key-proxy-selftest")
+	q.Set(aliyunTimestampKey, now.UTC().Format(aliyunTimestampFormat))
+	q.Set(aliyunAccessKeIdyKey, credential.AccessKey)
+	q.Set(aliyunSignatureKey, "selftest")
+	return http.NewRequest(http.MethodGet, "https://cdn.aliyuncs.com/?"+base.QuickEncode(q), nil)
+}
+
+// quarantineResponse renders the errors of the RPC APIs of Aliyun.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	if reason == provider.QuarantineInvalidAccessKey {
+		return provider.JSONResponse(http.StatusNotFound, map[string]string{
+			"RequestId": requestId, "Code": "InvalidAccessKeyId.NotFound", "Message": "Specified access key is not found."})
+	}
+	return provider.JSONResponse(http.StatusBadRequest, map[string]string{
+		"RequestId": requestId, "Code": "SignatureDoesNotMatch", "Message": "Specified signature is not matched with our calculation."})
+}
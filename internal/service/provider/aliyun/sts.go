@@ -0,0 +1,100 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package aliyun
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/service/provider"
+)
+
+const (
+	stsDefaultEndpoint = "https://sts.aliyuncs.com"
+	stsVersion         = "2015-04-01"
+)
+
+type assumeRoleResponse struct {
+	Code        string
+	Message     string
+	Credentials struct {
+		AccessKeyId     string
+		AccessKeySecret string
+		SecurityToken   string
+		Expiration      time.Time
+	}
+}
+
+// assumeRole calls AssumeRole of Aliyun STS.
+func assumeRole(ctx context.Context, client *http.Client, cre common.Credential, role common.AssumeRole) (provider.RoleSession, error) {
+	endpoint := role.Endpoint
+	if endpoint == "" {
+		endpoint = stsDefaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	u.Path = "/"
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return provider.RoleSession{}, err
+	}
+	q := url.Values{
+		"Action":             {"AssumeRole"},
+		"Version":            {stsVersion},
+		"Format":             {"JSON"},
+		"RoleArn":            {role.RoleArn},
+		"RoleSessionName":    {role.SessionName},
+		"DurationSeconds":    {strconv.Itoa(role.Duration)},
+		"SignatureMethod":    {"HMAC-SHA1"},
+		"SignatureVersion":   {"1.0"},
+		"SignatureNonce":     {hex.EncodeToString(nonce)},
+		"Timestamp":          {time.Now().UTC().Format(aliyunTimestampFormat)},
+		aliyunAccessKeIdyKey: {cre.AccessKey},
+	}
+	if role.ExternalId != "" {
+		q.Set("ExternalId", role.ExternalId)
+	}
+	if cre.AccessToken != "" {
+		q.Set(aliyunSecurityTokenKey, cre.AccessToken)
+	}
+	q.Set(aliyunSignatureKey, (&aliyunProvider{}).sign(http.MethodGet, q, cre.SecretKey))
+	u.RawQuery = base.QuickEncode(q)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	body, err := provider.CallSTS(client, req)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	var resp assumeRoleResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return provider.RoleSession{}, fmt.Errorf("decode response failed: %v", err)
+	}
+	if resp.Code != "" {
+		return provider.RoleSession{}, fmt.Errorf("%s: %s", resp.Code, resp.Message)
+	}
+	return provider.RoleSession{
+		Credential: common.Credential{
+			AccessKey:   resp.Credentials.AccessKeyId,
+			SecretKey:   resp.Credentials.AccessKeySecret,
+			AccessToken: resp.Credentials.SecurityToken,
+		},
+		Expiration: resp.Credentials.Expiration,
+	}, nil
+}
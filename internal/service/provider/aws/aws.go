@@ -11,8 +11,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
+	"github.com/volcengine/key-proxy/internal/utils"
+	"mime"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -20,6 +24,7 @@ import (
 const (
 	authorizationHeader = "Authorization"
 	signTimeHeader      = "X-Amz-Date"
+	targetHeader        = "X-Amz-Target"
 	awsRegionKey        = "AwsRegion"
 	awsTimeKey          = "AwsTime"
 	awsService          = "AwsService"
@@ -30,6 +35,15 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &awsProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.amazonaws.com", "*.amazonaws.com.cn")
+	provider.RegisterProbeHosts(vendorName, "cloudfront.amazonaws.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{
+		Headers: []string{authorizationHeader, "X-Amz-Security-Token"},
+		Query:   []string{"X-Amz-Signature", "X-Amz-Security-Token"},
+	})
+	provider.RegisterRoleAssumer(vendorName, assumeRole)
 }
 
 type awsProvider struct {
@@ -58,6 +72,7 @@ func (s *awsProvider) ValidateRequest(ctx context.Context, req *http.Request) (c
 	ctx = context.WithValue(ctx, awsTimeKey, signTime)
 	ctx = context.WithValue(ctx, awsService, service)
 	ctx = context.WithValue(ctx, awsRegionKey, region)
+	ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Signature: requestSign})
 	cre := s.Credentials.Proxy
 	err = signRequest(ctx, req, cre.AccessKey, cre.SecretKey, cre.AccessToken, region, service, signTime)
 	if err != nil {
@@ -80,3 +95,73 @@ func (s *awsProvider) ResignRequest(ctx context.Context, req *http.Request) erro
 	}
 	return nil
 }
+
+// Operation uses X-Amz-Target for JSON APIs, Action for query APIs, and the method and path for REST APIs. The query
+// APIs like IAM, EC2 and STS may post Action in a form body, the action is left empty if it is missing or ambiguous,
+// so that the policies fail closed.
+func (s *awsProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	service, _ := ctx.Value(awsService).(string)
+	region, _ := ctx.Value(awsRegionKey).(string)
+	if target := req.Header.Get(targetHeader); target != "" {
+		return provider.Operation{Service: service, Action: target, Region: region}
+	}
+	actions := req.URL.Query()["Action"]
+	if isFormRequest(req) {
+		body, err := utils.CopyRequestBody(req)
+		if err != nil {
+			return provider.Operation{Service: service, Region: region}
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return provider.Operation{Service: service, Region: region}
+		}
+		actions = append(actions, form["Action"]...)
+		if len(actions) == 0 {
+			return provider.Operation{Service: service, Region: region}
+		}
+	}
+	if len(actions) > 0 {
+		for _, action := range actions[1:] {
+			if action != actions[0] {
+				return provider.Operation{Service: service, Region: region}
+			}
+		}
+		return provider.Operation{Service: service, Action: actions[0], Region: region}
+	}
+	operation := provider.RestOperation(service, req)
+	operation.Region = region
+	return operation
+}
+
+// isFormRequest reports whether the parameters of a query API are posted in the body.
+func isFormRequest(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *awsProvider) ProxyAccessKey(req *http.Request) string {
+	return provider.CredentialScopeAccessKey(req.Header.Get(authorizationHeader))
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://cloudfront.amazonaws.com/2020-05-31/distribution", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(signTimeHeader, now.UTC().Format("20060102T150405Z"))
+	req.Header.Set(authorizationHeader, fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s/us-east-1/cloudfront/aws4_request, SignedHeaders=host;x-amz-date, Signature=selftest",
+		credential.AccessKey, now.UTC().Format("20060102")))
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the query APIs of AWS.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	code, message := "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	if reason == provider.QuarantineInvalidAccessKey {
+		code, message = "InvalidClientTokenId", "The security token included in the request is invalid."
+	}
+	return provider.XMLResponse(http.StatusForbidden, fmt.Sprintf(
+		"<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>%s</RequestId></ErrorResponse>",
+		code, message, requestId))
+}
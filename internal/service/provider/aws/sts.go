@@ -0,0 +1,88 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package aws
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/service/provider"
+)
+
+const (
+	stsDefaultRegion   = "us-east-1"
+	stsDefaultEndpoint = "https://sts.amazonaws.com"
+	stsVersion         = "2011-06-15"
+)
+
+type assumeRoleResponse struct {
+	Result struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		}
+	} `xml:"AssumeRoleResult"`
+}
+
+// assumeRole calls AssumeRole of AWS STS.
+func assumeRole(ctx context.Context, client *http.Client, cre common.Credential, role common.AssumeRole) (provider.RoleSession, error) {
+	region := role.Region
+	endpoint := role.Endpoint
+	if endpoint == "" && region != "" {
+		endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com", region)
+	}
+	if endpoint == "" {
+		endpoint = stsDefaultEndpoint
+	}
+	if region == "" {
+		region = stsDefaultRegion
+	}
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {stsVersion},
+		"RoleArn":         {role.RoleArn},
+		"RoleSessionName": {role.SessionName},
+		"DurationSeconds": {strconv.Itoa(role.Duration)},
+	}
+	if role.ExternalId != "" {
+		form.Set("ExternalId", role.ExternalId)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := signRequest(ctx, req, cre.AccessKey, cre.SecretKey, cre.AccessToken, region, "sts", time.Now()); err != nil {
+		return provider.RoleSession{}, err
+	}
+	body, err := provider.CallSTS(client, req)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	var resp assumeRoleResponse
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return provider.RoleSession{}, fmt.Errorf("decode response failed: %v", err)
+	}
+	credentials := resp.Result.Credentials
+	return provider.RoleSession{
+		Credential: common.Credential{
+			AccessKey:   credentials.AccessKeyId,
+			SecretKey:   credentials.SecretAccessKey,
+			AccessToken: credentials.SessionToken,
+		},
+		Expiration: credentials.Expiration,
+	}, nil
+}
@@ -10,8 +10,10 @@ import (
 	"context"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -24,6 +26,11 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &baiduProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.baidubce.com")
+	provider.RegisterProbeHosts(vendorName, "cdn.baidubce.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{Headers: []string{"Authorization", "X-Bce-Security-Token"}})
 }
 
 type baiduProvider struct {
@@ -44,6 +51,7 @@ func (s *baiduProvider) ValidateRequest(ctx context.Context, req *http.Request)
 	}
 	computedSign := getSignature(req, s.Credentials.Proxy.AccessKey, s.Credentials.Proxy.SecretKey, signTime.Unix())
 	ctx = context.WithValue(ctx, signTimeKey, signTime.Unix())
+	ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Signature: requestSign})
 	return ctx, requestSign == computedSign, nil
 }
 
@@ -53,3 +61,36 @@ func (s *baiduProvider) ResignRequest(ctx context.Context, req *http.Request) er
 	req.Header.Set(authorizationKey, signature)
 	return nil
 }
+
+func (s *baiduProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	return provider.RestOperation(provider.HostService(req.URL.Hostname()), req)
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *baiduProvider) ProxyAccessKey(req *http.Request) string {
+	// bce-auth-v1/{accessKeyId}/{timestamp}/{expirationPeriodInSeconds}/{signedHeaders}/{signature}
+	if items := strings.Split(req.Header.Get(authorizationKey), "/"); len(items) > 1 {
+		return items[1]
+	}
+	return ""
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://cdn.baidubce.com/v2/domain", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-bce-date", now.UTC().Format(iso8601Format))
+	req.Header.Set(authorizationKey, fmt.Sprintf("bce-auth-v1/%s/%s/1800/host;x-bce-date/selftest",
+		credential.AccessKey, now.UTC().Format(iso8601Format)))
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the BCE APIs of Baidu AI Cloud.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	code, message := "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	if reason == provider.QuarantineInvalidAccessKey {
+		code, message = "InvalidAccessKeyId", "The Access Key ID you provided does not exist in our records."
+	}
+	return provider.JSONResponse(http.StatusForbidden, map[string]string{"requestId": requestId, "code": code, "message": message})
+}
@@ -10,9 +10,11 @@ import (
 	"context"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 const (
@@ -24,6 +26,13 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &baishanProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.baishan.com", "*.baishancloud.com")
+	provider.RegisterProbeHosts(vendorName, "cdn.api.baishan.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	// the static token carries no signing time, so the requests cannot be checked for replays
+	provider.RegisterReplayExempt(vendorName)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{Query: []string{tokenKey}})
 }
 
 type baishanProvider struct {
@@ -55,3 +64,16 @@ func (s *baishanProvider) ResignRequest(ctx context.Context, req *http.Request)
 	req.URL.RawQuery = query.Encode()
 	return nil
 }
+
+func (s *baishanProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	return provider.RestOperation("cdn", req)
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	return http.NewRequest(http.MethodGet, "https://cdn.api.baishan.com/v2/domain/list?"+url.Values{tokenKey: {credential.AccessToken}}.Encode(), nil)
+}
+
+// quarantineResponse renders the errors of the APIs of Baishan, which do not tell the bad tokens apart.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	return provider.JSONResponse(http.StatusUnauthorized, map[string]interface{}{"code": 400001, "message": "token is invalid"})
+}
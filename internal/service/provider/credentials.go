@@ -0,0 +1,190 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/utils"
+)
+
+// AccessKeyParser is implemented by the providers which can tell the proxy access key from the signature, so that
+// only the proxy credentials with that access key are tried.
+type AccessKeyParser interface {
+	// ProxyAccessKey is called before ValidateRequest and must not change the request.
+	ProxyAccessKey(req *http.Request) string
+}
+
+// proxyCandidate is the provider built with one of the proxy credentials of the cloud account.
+type proxyCandidate struct {
+	IProvider
+	name       string
+	credential common.ProxyCredential
+	notAfter   time.Time // the earlier of NotAfter and the end of the max age
+}
+
+func (c *proxyCandidate) started(now time.Time) bool {
+	return c.credential.NotBefore.IsZero() || !now.Before(c.credential.NotBefore)
+}
+
+func (c *proxyCandidate) expired(now time.Time) bool {
+	return !c.notAfter.IsZero() && !now.Before(c.notAfter)
+}
+
+func (c *proxyCandidate) matches(accessKey string) bool {
+	return accessKey == c.credential.AccessKey || accessKey == c.credential.ClientToken
+}
+
+// newProxyCandidates builds a provider for each of the proxy credentials, the single Proxy credential goes first.
+func newProxyCandidates(registerFunc RegisterFunc, credentials common.Credentials, maxAge time.Duration) []*proxyCandidate {
+	proxies := credentials.Proxies
+	if credentials.Proxy != (common.Credential{}) || len(proxies) == 0 {
+		proxies = append([]common.ProxyCredential{{Credential: credentials.Proxy, Name: "Proxy", Validity: credentials.ProxyValidity}}, proxies...)
+	}
+	candidates := make([]*proxyCandidate, 0, len(proxies))
+	for i, proxy := range proxies {
+		cre := credentials
+		cre.Proxy = proxy.Credential
+		name := proxy.Name
+		if name == "" {
+			name = proxy.AccessKey
+		}
+		if name == "" {
+			name = fmt.Sprintf("Proxies[%d]", i)
+		}
+		notAfter := proxy.NotAfter
+		if maxAge > 0 && !proxy.CreatedAt.IsZero() {
+			if end := proxy.CreatedAt.Add(maxAge); notAfter.IsZero() || end.Before(notAfter) {
+				notAfter = end
+			}
+		}
+		candidates = append(candidates, &proxyCandidate{
+			IProvider:  registerFunc(cre),
+			name:       name,
+			credential: proxy,
+			notAfter:   notAfter,
+		})
+	}
+	return candidates
+}
+
+// validate validates the request with the started proxy credentials, and returns the matched one. The expired
+// credentials are tried last, so that the caller can tell the request is signed with an expired credential.
+// When several credentials have to be tried, all but the last are tried on copies of the request, since
+// ValidateRequest may change the request.
+func (p *endpointProvider) validate(ctx context.Context, req *http.Request, now time.Time) (context.Context, *proxyCandidate, bool, error) {
+	candidates := make([]*proxyCandidate, 0, len(p.candidates))
+	var expired []*proxyCandidate
+	for _, candidate := range p.candidates {
+		if !candidate.started(now) {
+			continue
+		}
+		if candidate.expired(now) {
+			expired = append(expired, candidate)
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	candidates = append(candidates, expired...)
+	if parser, ok := p.IProvider.(AccessKeyParser); ok {
+		if accessKey := parser.ProxyAccessKey(req); accessKey != "" {
+			matched := make([]*proxyCandidate, 0, 1)
+			for _, candidate := range candidates {
+				if candidate.matches(accessKey) {
+					matched = append(matched, candidate)
+				}
+			}
+			if len(matched) > 0 {
+				candidates = matched
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return ctx, nil, false, nil
+	}
+
+	for _, candidate := range candidates[:len(candidates)-1] {
+		trial, err := copyRequest(ctx, req)
+		if err != nil {
+			return ctx, nil, false, err
+		}
+		if _, ok, err := candidate.ValidateRequest(ctx, trial); err == nil && ok {
+			ctx, ok, err = candidate.ValidateRequest(ctx, req)
+			return ctx, candidate, ok, err
+		}
+	}
+	candidate := candidates[len(candidates)-1]
+	ctx, ok, err := candidate.ValidateRequest(ctx, req)
+	return ctx, candidate, ok, err
+}
+
+func copyRequest(ctx context.Context, req *http.Request) (*http.Request, error) {
+	body, err := utils.CopyRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	trial := req.Clone(ctx)
+	trial.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return trial, nil
+}
+
+// CredentialScopeAccessKey gets the access key from authorizations like "HMAC-SHA256 Credential=AK/date/region/...".
+func CredentialScopeAccessKey(authorization string) string {
+	return AuthorizationField(authorization, "Credential", "/")
+}
+
+// AuthorizationField gets the value of "key=" till the separator in authorizations like
+// "SDK-HMAC-SHA256 Access=AK, Signature=...", an empty string is returned if the key is absent.
+func AuthorizationField(authorization, key, separator string) string {
+	index := strings.Index(authorization, key+"=")
+	if index < 0 {
+		return ""
+	}
+	value := authorization[index+len(key)+1:]
+	if end := strings.Index(value, separator); end >= 0 {
+		value = value[:end]
+	}
+	return strings.TrimSpace(value)
+}
+
+// ProxyCredentialExpiry is the expiry of a proxy credential of the cloud account.
+type ProxyCredentialExpiry struct {
+	CloudAccountName string
+	Credential       string
+	NotAfter         time.Time
+}
+
+// ProxyCredentialExpiries lists the proxy credentials which expire, sorted by their expiry.
+func (s *ImplProviderService) ProxyCredentialExpiries() []ProxyCredentialExpiry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var expiries []ProxyCredentialExpiry
+	for name, provider := range s.endpointProviders {
+		for _, candidate := range provider.candidates {
+			if candidate.notAfter.IsZero() {
+				continue
+			}
+			expiries = append(expiries, ProxyCredentialExpiry{
+				CloudAccountName: name,
+				Credential:       candidate.name,
+				NotAfter:         candidate.notAfter,
+			})
+		}
+	}
+	sort.Slice(expiries, func(i, j int) bool {
+		return expiries[i].NotAfter.Before(expiries[j].NotAfter)
+	})
+	return expiries
+}
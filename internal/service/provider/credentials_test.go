@@ -0,0 +1,165 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+const testBody = "payload"
+
+// fakeProvider accepts the requests whose X-Test-Key is its proxy access key, and records the access keys it tried.
+type fakeProvider struct {
+	accessKey string
+	tried     *[]string
+}
+
+func (p *fakeProvider) ValidateRequest(ctx context.Context, req *http.Request) (context.Context, bool, error) {
+	*p.tried = append(*p.tried, p.accessKey)
+	// the body is consumed like the providers which hash it
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil || string(body) != testBody {
+		return ctx, false, err
+	}
+	return ctx, req.Header.Get("X-Test-Key") == p.accessKey, nil
+}
+
+func (p *fakeProvider) ResignRequest(ctx context.Context, req *http.Request) error {
+	return nil
+}
+
+func (p *fakeProvider) Operation(ctx context.Context, req *http.Request) Operation {
+	return Operation{}
+}
+
+func (p *fakeProvider) String() string {
+	return "fake"
+}
+
+// fakeParserProvider tells the proxy access key from X-Test-Key.
+type fakeParserProvider struct {
+	*fakeProvider
+}
+
+func (p fakeParserProvider) ProxyAccessKey(req *http.Request) string {
+	return req.Header.Get("X-Test-Key")
+}
+
+func newFakeProvider(tried *[]string, parser bool) RegisterFunc {
+	return func(credentials common.Credentials) IProvider {
+		provider := &fakeProvider{accessKey: credentials.Proxy.AccessKey, tried: tried}
+		if parser {
+			return fakeParserProvider{provider}
+		}
+		return provider
+	}
+}
+
+func TestNewProxyCandidates(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	credentials := common.Credentials{
+		Proxy: common.Credential{AccessKey: "ak0"},
+		Proxies: []common.ProxyCredential{
+			{Credential: common.Credential{AccessKey: "ak1"}, Name: "named"},
+			{Credential: common.Credential{AccessKey: "ak2"}, Validity: common.Validity{CreatedAt: created}},
+			{Credential: common.Credential{ClientToken: "token"}, Validity: common.Validity{CreatedAt: created, NotAfter: created.Add(time.Hour)}},
+		},
+	}
+	var tried []string
+	candidates := newProxyCandidates(newFakeProvider(&tried, false), credentials, 24*time.Hour)
+	var names []string
+	for _, candidate := range candidates {
+		names = append(names, candidate.name)
+	}
+	if want := []string{"Proxy", "named", "ak2", "Proxies[3]"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("candidates are %v, want %v", names, want)
+	}
+	notAfters := []time.Time{{}, {}, created.Add(24 * time.Hour), created.Add(time.Hour)}
+	for i, candidate := range candidates {
+		if !candidate.notAfter.Equal(notAfters[i]) {
+			t.Errorf("%s expires at %s, want %s", candidate.name, candidate.notAfter, notAfters[i])
+		}
+	}
+
+	// without Proxy, only the Proxies are candidates
+	credentials.Proxy = common.Credential{}
+	if candidates = newProxyCandidates(newFakeProvider(&tried, false), credentials, 0); len(candidates) != 3 || candidates[0].name != "named" {
+		t.Errorf("%d candidates without Proxy, the first is %s", len(candidates), candidates[0].name)
+	}
+}
+
+func TestValidateCandidates(t *testing.T) {
+	now := time.Now()
+	credentials := common.Credentials{
+		Proxy: common.Credential{AccessKey: "current"},
+		Proxies: []common.ProxyCredential{
+			{Credential: common.Credential{AccessKey: "expired"}, Validity: common.Validity{NotAfter: now.Add(-time.Hour)}},
+			{Credential: common.Credential{AccessKey: "future"}, Validity: common.Validity{NotBefore: now.Add(time.Hour)}},
+			{Credential: common.Credential{AccessKey: "next"}, Validity: common.Validity{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}},
+		},
+	}
+	cases := []struct {
+		name      string
+		parser    bool
+		key       string
+		candidate string
+		ok        bool
+		expired   bool
+		tried     []string
+	}{
+		{"first credential", false, "current", "Proxy", true, false, []string{"current", "current"}},
+		{"second credential", false, "next", "next", true, false, []string{"current", "next", "next"}},
+		{"expired credential is tried last", false, "expired", "expired", true, true, []string{"current", "next", "expired"}},
+		{"credential not started", false, "future", "expired", false, true, []string{"current", "next", "expired"}},
+		{"wrong credential", false, "wrong", "expired", false, true, []string{"current", "next", "expired"}},
+		{"parsed access key", true, "next", "next", true, false, []string{"next"}},
+		{"parsed expired access key", true, "expired", "expired", true, true, []string{"expired"}},
+		{"parsed unknown access key", true, "wrong", "expired", false, true, []string{"current", "next", "expired"}},
+	}
+	for _, c := range cases {
+		var tried []string
+		provider := newEndpointProvider(newFakeProvider(&tried, c.parser), common.Endpoint{}, credentials, nil, 0, nil)
+		req := httptest.NewRequest("POST", "/", strings.NewReader(testBody))
+		req.Header.Set("X-Test-Key", c.key)
+		_, candidate, ok, err := provider.validate(context.Background(), req, now)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if candidate == nil || candidate.name != c.candidate || ok != c.ok || candidate.expired(now) != c.expired {
+			t.Errorf("%s: candidate is %v, ok is %v", c.name, candidate, ok)
+		}
+		if !reflect.DeepEqual(tried, c.tried) {
+			t.Errorf("%s: tried %v, want %v", c.name, tried, c.tried)
+		}
+	}
+}
+
+func TestValidateWithoutStartedCandidates(t *testing.T) {
+	now := time.Now()
+	credentials := common.Credentials{
+		Proxies: []common.ProxyCredential{
+			{Credential: common.Credential{AccessKey: "future"}, Validity: common.Validity{NotBefore: now.Add(time.Hour)}},
+		},
+	}
+	var tried []string
+	provider := newEndpointProvider(newFakeProvider(&tried, false), common.Endpoint{}, credentials, nil, 0, nil)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(testBody))
+	req.Header.Set("X-Test-Key", "future")
+	_, candidate, ok, err := provider.validate(context.Background(), req, now)
+	if candidate != nil || ok || err != nil || len(tried) > 0 {
+		t.Errorf("candidate is %v, ok is %v, error is %v, tried %v", candidate, ok, err, tried)
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+// Vendors lists the registered vendors.
+func Vendors() []string {
+	vendors := make([]string, 0, len(providers))
+	for vendor := range providers {
+		vendors = append(vendors, vendor)
+	}
+	return vendors
+}
+
+// SignSample builds the sample request of the vendor and signs it with the credential, like a client of the proxy.
+func SignSample(vendor string, credential common.Credential, now time.Time) (*http.Request, error) {
+	sample, found := sampleRequests[vendor]
+	if !found {
+		return nil, fmt.Errorf("no sample request is registered by %s", vendor)
+	}
+	provider := providers[vendor](common.Credentials{Proxy: credential, Real: credential})
+	req, err := sample(credential, now)
+	if err != nil {
+		return nil, err
+	}
+	ctx, _, err := provider.ValidateRequest(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	return req, provider.ResignRequest(ctx, req)
+}
@@ -10,8 +10,11 @@ import (
 	"context"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const (
@@ -23,6 +26,11 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &huaweiProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.myhuaweicloud.com", "*.huaweicloud.com")
+	provider.RegisterProbeHosts(vendorName, "cdn.myhuaweicloud.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{Headers: []string{"Authorization", "X-Security-Token"}})
 }
 
 type huaweiProvider struct {
@@ -36,6 +44,9 @@ func (s *huaweiProvider) String() string {
 func (s *huaweiProvider) ValidateRequest(ctx context.Context, req *http.Request) (context.Context, bool, error) {
 	requestSign := req.Header.Get(huaweiSignatureKey)
 	req.Header.Del(huaweiSignatureKey)
+	if signTime, err := time.Parse(BasicDateFormat, req.Header.Get(HeaderXDate)); err == nil {
+		ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Signature: requestSign})
+	}
 	computedSign, err := Sign(s.Credentials.Proxy.AccessKey, s.Credentials.Proxy.SecretKey, req)
 	if err != nil {
 		return ctx, false, fmt.Errorf("compute signature failed: %v", err)
@@ -51,3 +62,32 @@ func (s *huaweiProvider) ResignRequest(ctx context.Context, req *http.Request) e
 	req.Header.Set(huaweiSignatureKey, computedSign)
 	return nil
 }
+
+func (s *huaweiProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	return provider.RestOperation(provider.HostService(req.URL.Hostname()), req)
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *huaweiProvider) ProxyAccessKey(req *http.Request) string {
+	return provider.AuthorizationField(req.Header.Get(huaweiSignatureKey), "Access", ",")
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://cdn.myhuaweicloud.com/v1.0/cdn/domains", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(HeaderXDate, now.UTC().Format(BasicDateFormat))
+	req.Header.Set(huaweiSignatureKey, fmt.Sprintf("SDK-HMAC-SHA256 Access=%s, SignedHeaders=host;x-sdk-date, Signature=selftest", credential.AccessKey))
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the API gateway of Huawei Cloud.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	message := "Incorrect IAM authentication information: verify aksk signature fail"
+	if reason == provider.QuarantineInvalidAccessKey {
+		message = "Incorrect IAM authentication information: ak is invalid"
+	}
+	return provider.JSONResponse(http.StatusUnauthorized, map[string]string{
+		"error_code": "APIGW.0301", "error_msg": message, "request_id": strings.ReplaceAll(requestId, "-", "")})
+}
@@ -12,6 +12,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"github.com/volcengine/key-proxy/internal/utils"
 	"net/http"
@@ -32,6 +33,11 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &jingdongProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.jdcloud-api.com")
+	provider.RegisterProbeHosts(vendorName, "cdn.jdcloud-api.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{Headers: []string{"Authorization", "X-Jdcloud-Security-Token"}})
 }
 
 type jingdongProvider struct {
@@ -63,6 +69,7 @@ func (s *jingdongProvider) ValidateRequest(ctx context.Context, req *http.Reques
 	ctx = context.WithValue(ctx, serviceKey, service)
 	ctx = context.WithValue(ctx, regionKey, region)
 	ctx = context.WithValue(ctx, uuidKey, uuidStr)
+	ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Nonce: uuidStr, Signature: requestSign})
 	cre := s.Credentials.Proxy
 
 	signer := NewSigner(Credential{
@@ -101,3 +108,40 @@ func (s *jingdongProvider) ResignRequest(ctx context.Context, req *http.Request)
 	}
 	return nil
 }
+
+func (s *jingdongProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	service, _ := ctx.Value(serviceKey).(string)
+	region, _ := ctx.Value(regionKey).(string)
+	operation := provider.RestOperation(service, req)
+	operation.Region = region
+	return operation
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *jingdongProvider) ProxyAccessKey(req *http.Request) string {
+	return provider.CredentialScopeAccessKey(req.Header.Get(authorizationHeader))
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://cdn.jdcloud-api.com/v1/domain", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(signTimeHeaderKey, now.UTC().Format(timeFormat))
+	req.Header.Set(uuidHeaderKey, "key-proxy-selftest")
+	req.Header.Set(authorizationHeader, fmt.Sprintf("%s Credential=%s/%s/cn-north-1/cdn/jdcloud2_request, SignedHeaders=host;x-jdcloud-date;x-jdcloud-nonce, Signature=selftest",
+		authHeaderPrefix, credential.AccessKey, now.UTC().Format("20060102")))
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the OpenAPI of JD Cloud.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	message := "signature does not match"
+	if reason == provider.QuarantineInvalidAccessKey {
+		message = "access key is invalid"
+	}
+	return provider.JSONResponse(http.StatusUnauthorized, map[string]interface{}{
+		"requestId": strings.ReplaceAll(requestId, "-", ""),
+		"error":     map[string]interface{}{"code": http.StatusUnauthorized, "status": "UNAUTHENTICATED", "message": message},
+	})
+}
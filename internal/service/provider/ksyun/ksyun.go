@@ -11,6 +11,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
 	"strings"
@@ -32,6 +33,14 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &ksyunProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.ksyun.com")
+	provider.RegisterProbeHosts(vendorName, "cdn.api.ksyun.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{
+		Headers: []string{"Authorization", "X-Amz-Security-Token"},
+		Query:   []string{"X-Amz-Signature", "X-Amz-Security-Token"},
+	})
 }
 
 type ksyunProvider struct {
@@ -49,6 +58,9 @@ func (s *ksyunProvider) ValidateRequest(ctx context.Context, req *http.Request)
 		return ctx, false, err
 	}
 	fakeToken := req.Header.Get(Authorization)
+	if signTime, err := time.ParseInLocation("20060102T150405Z", req.Header.Get(X_Amz_Date), time.UTC); err == nil {
+		ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Signature: token})
+	}
 	return ctx, fakeToken == token, nil
 }
 
@@ -90,3 +102,39 @@ func (s *ksyunProvider) sign(req *http.Request, cre common.Credential) error {
 	}
 	return nil
 }
+
+func (s *ksyunProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	region := ""
+	if items := strings.Split(req.Header.Get(Authorization), "/"); len(items) >= 3 {
+		region = items[2]
+	}
+	return provider.Operation{Service: "cdn", Action: req.URL.Query().Get("Action"), Region: region}
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *ksyunProvider) ProxyAccessKey(req *http.Request) string {
+	return provider.CredentialScopeAccessKey(req.Header.Get(Authorization))
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://cdn.api.ksyun.com/2016-09-01/domain/GetCdnDomains?Action=GetCdnDomains&Version=2016-09-01", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(X_Amz_Date, now.UTC().Format("20060102T150405Z"))
+	req.Header.Set(Authorization, fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s/cn-beijing-6/cdn/aws4_request, SignedHeaders=host;x-amz-date, Signature=selftest",
+		credential.AccessKey, now.UTC().Format("20060102")))
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the OpenAPI of Kingsoft Cloud.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	code, message := "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	if reason == provider.QuarantineInvalidAccessKey {
+		code, message = "InvalidClientTokenId", "The security token included in the request is invalid."
+	}
+	return provider.JSONResponse(http.StatusForbidden, map[string]interface{}{
+		"RequestId": requestId,
+		"Error":     map[string]string{"Type": "Sender", "Code": code, "Message": message},
+	})
+}
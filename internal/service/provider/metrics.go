@@ -0,0 +1,23 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	validationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "key_proxy_validation_failures_total",
+		Help: "Requests whose proxy signature could not be validated.",
+	}, []string{"vendor", "cloud_account"})
+	resignErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "key_proxy_resign_errors_total",
+		Help: "Requests which could not be resigned with the real credential.",
+	}, []string{"vendor", "cloud_account"})
+)
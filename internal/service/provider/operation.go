@@ -0,0 +1,161 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+var (
+	// readOnlyVerbs are the first words of RPC-style actions which do not change anything,
+	// any other action is treated as mutating.
+	readOnlyVerbs = map[string]bool{
+		"Describe": true, "Get": true, "List": true, "Query": true, "Check": true,
+		"Search": true, "Show": true, "View": true, "Lookup": true, "Head": true,
+	}
+	// mutatingWords turn an action with a read-only verb into a mutating one, like "CheckInLicense" or
+	// "GetPasswordAndResetIt". Nouns like "Refresh" of "DescribeRefreshTasks" are not included.
+	mutatingWords = map[string]bool{
+		"And": true, "In": true, "Out": true, "Reset": true, "Create": true, "Delete": true, "Update": true,
+		"Modify": true, "Set": true, "Put": true, "Add": true, "Remove": true, "Start": true, "Stop": true,
+		"Enable": true, "Disable": true, "Attach": true, "Detach": true, "Apply": true, "Submit": true,
+		"Restore": true, "Rotate": true, "Revoke": true, "Grant": true, "Release": true, "Allocate": true,
+		"Assign": true, "Bind": true, "Unbind": true, "Run": true, "Terminate": true, "Cancel": true,
+		"Copy": true, "Upload": true, "Clear": true, "Register": true, "Acquire": true, "Lock": true, "Unlock": true,
+	}
+)
+
+// Operation is the vendor API called by the request.
+type Operation struct {
+	Service string
+	Action  string // empty if the action cannot be determined, which fails any policy
+	Region  string
+	Method  string // http method of REST-style APIs, empty for RPC-style APIs
+}
+
+// String formats the operation as "service:action", which is matched by the patterns of policies.
+func (o Operation) String() string {
+	return o.Service + ":" + o.Action
+}
+
+// RestOperation builds the operation of REST-style APIs, the action is like "GET /v2/domains".
+func RestOperation(service string, req *http.Request) Operation {
+	return Operation{
+		Service: service,
+		Action:  req.Method + " " + req.URL.Path,
+		Method:  req.Method,
+	}
+}
+
+// IsReadOnly reports whether the operation does not change anything. REST-style operations are read-only
+// if the method is GET or HEAD, RPC-style ones if the first word of the action is a read-only verb like
+// "Describe" and no other word is a mutating one. Unknown actions are not read-only.
+func (o Operation) IsReadOnly() bool {
+	if o.Method != "" {
+		return o.Method == http.MethodGet || o.Method == http.MethodHead
+	}
+	action := o.Action
+	// actions from X-Amz-Target are like "DynamoDB_20120810.GetItem"
+	if i := strings.LastIndexByte(action, '.'); i >= 0 {
+		action = action[i+1:]
+	}
+	words := splitWords(action)
+	if len(words) == 0 || !readOnlyVerbs[words[0]] {
+		return false
+	}
+	for _, word := range words[1:] {
+		if mutatingWords[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitWords splits the CamelCase action into words, e.g. "DescribeCDNDomains" into "Describe", "CDN" and
+// "Domains". Digits and other characters stay in the word they follow.
+func splitWords(action string) []string {
+	var words []string
+	start := 0
+	for i := 1; i < len(action); i++ {
+		if !isUpper(action[i]) {
+			continue
+		}
+		// a word starts at an upper case letter after a lower case one, or before a lower case one in acronyms
+		if !isUpper(action[i-1]) || (i+1 < len(action) && isLower(action[i+1])) {
+			words = append(words, action[start:i])
+			start = i
+		}
+	}
+	if start < len(action) {
+		words = append(words, action[start:])
+	}
+	return words
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+// HostService gets the service from the first label of the host, e.g. "cdn" of "cdn.aliyuncs.com".
+func HostService(host string) string {
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		return host[:i]
+	}
+	return host
+}
+
+// checkPolicy denies the operation if it matches any deny pattern, or the allow patterns are configured
+// and none of them matches. The operations with unknown actions are denied if any pattern is configured.
+func checkPolicy(policy common.Policy, operation Operation) error {
+	if operation.Action == "" && (len(policy.Allow) > 0 || len(policy.Deny) > 0) {
+		return fmt.Errorf("the action of service %s cannot be determined", operation.Service)
+	}
+	name := operation.String()
+	for _, pattern := range policy.Deny {
+		if matchWildcard(pattern, name) {
+			return fmt.Errorf("operation %s is denied by %q", name, pattern)
+		}
+	}
+	if len(policy.Allow) == 0 {
+		return nil
+	}
+	for _, pattern := range policy.Allow {
+		if matchWildcard(pattern, name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("operation %s is not allowed", name)
+}
+
+// matchWildcard matches the value with the pattern case-insensitively, "*" matches any characters.
+func matchWildcard(pattern, value string) bool {
+	pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
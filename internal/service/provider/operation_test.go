@@ -0,0 +1,103 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	listDomains := Operation{Service: "cdn", Action: "ListCdnDomains"}
+	deleteDomain := Operation{Service: "cdn", Action: "DeleteCdnDomain"}
+	restDomains := Operation{Service: "cdn", Action: "GET /v2/domains", Method: http.MethodGet}
+	unknown := Operation{Service: "cdn"}
+	cases := []struct {
+		name      string
+		policy    common.Policy
+		operation Operation
+		allowed   bool
+	}{
+		{"no policy", common.Policy{}, deleteDomain, true},
+		{"no policy with unknown action", common.Policy{}, unknown, true},
+		{"allowed", common.Policy{Allow: []string{"cdn:List*"}}, listDomains, true},
+		{"not allowed", common.Policy{Allow: []string{"cdn:List*"}}, deleteDomain, false},
+		{"case-insensitive", common.Policy{Allow: []string{"CDN:listcdn*"}}, listDomains, true},
+		{"wildcard in the middle", common.Policy{Allow: []string{"cdn:*Cdn*s"}}, listDomains, true},
+		{"whole name", common.Policy{Allow: []string{"cdn:ListCdn"}}, listDomains, false},
+		{"other service", common.Policy{Allow: []string{"dcdn:*"}}, listDomains, false},
+		{"denied", common.Policy{Deny: []string{"cdn:Delete*"}}, deleteDomain, false},
+		{"not denied", common.Policy{Deny: []string{"cdn:Delete*"}}, listDomains, true},
+		{"deny wins over allow", common.Policy{Allow: []string{"cdn:*"}, Deny: []string{"cdn:Delete*"}}, deleteDomain, false},
+		{"rest action", common.Policy{Allow: []string{"cdn:GET /v2/*"}}, restDomains, true},
+		{"unknown action with allow", common.Policy{Allow: []string{"*"}}, unknown, false},
+		{"unknown action with deny", common.Policy{Deny: []string{"cdn:Delete*"}}, unknown, false},
+	}
+	for _, c := range cases {
+		err := checkPolicy(c.policy, c.operation)
+		if (err == nil) != c.allowed {
+			t.Errorf("%s: %s allowed is %v (%v), want %v", c.name, c.operation, err == nil, err, c.allowed)
+		}
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	cases := []struct {
+		operation Operation
+		readOnly  bool
+	}{
+		{Operation{Service: "cdn", Action: "DescribeCdnDomainDetail"}, true},
+		{Operation{Service: "cdn", Action: "DescribeRefreshTasks"}, true},
+		{Operation{Service: "cdn", Action: "ListCdnDomains"}, true},
+		{Operation{Service: "cdn", Action: "CheckCdnDomainExist"}, true},
+		{Operation{Service: "dynamodb", Action: "DynamoDB_20120810.GetItem"}, true},
+		{Operation{Service: "cdn", Action: "GetCDNDomains"}, true},
+		// the verb must be a whole word
+		{Operation{Service: "license-manager", Action: "CheckoutLicense"}, false},
+		{Operation{Service: "elb", Action: "ListenerCreate"}, false},
+		{Operation{Service: "iam", Action: "Getaway"}, false},
+		// a read-only verb followed by a mutating word
+		{Operation{Service: "license-manager", Action: "CheckInLicense"}, false},
+		{Operation{Service: "license-manager", Action: "CheckOutBorrowLicense"}, false},
+		{Operation{Service: "ecs", Action: "GetPasswordAndResetIt"}, false},
+		{Operation{Service: "cdn", Action: "GetAndDeleteCache"}, false},
+		{Operation{Service: "dynamodb", Action: "DynamoDB_20120810.PutItem"}, false},
+		// unknown actions fail closed
+		{Operation{Service: "cdn", Action: ""}, false},
+		{Operation{Service: "cdn", Action: "describeCdnDomainDetail"}, false},
+		{Operation{Service: "cdn", Action: "PurgeCache"}, false},
+		// REST-style operations are classified by the method
+		{Operation{Service: "cdn", Action: "GET /v2/domains", Method: http.MethodGet}, true},
+		{Operation{Service: "cdn", Action: "HEAD /v2/domains", Method: http.MethodHead}, true},
+		{Operation{Service: "cdn", Action: "POST /v2/domains/query", Method: http.MethodPost}, false},
+		{Operation{Service: "cdn", Action: "DELETE /v2/domains/a", Method: http.MethodDelete}, false},
+	}
+	for _, c := range cases {
+		if readOnly := c.operation.IsReadOnly(); readOnly != c.readOnly {
+			t.Errorf("%s (%s): read-only is %v, want %v", c.operation, c.operation.Method, readOnly, c.readOnly)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	cases := map[string][]string{
+		"DescribeCdnDomains": {"Describe", "Cdn", "Domains"},
+		"GetCDNDomains":      {"Get", "CDN", "Domains"},
+		"ListV2Domains":      {"List", "V2", "Domains"},
+		"GetObjectACL":       {"Get", "Object", "ACL"},
+		"Get":                {"Get"},
+		"":                   nil,
+	}
+	for action, want := range cases {
+		if words := splitWords(action); !reflect.DeepEqual(words, want) {
+			t.Errorf("%q: words are %q, want %q", action, words, want)
+		}
+	}
+}
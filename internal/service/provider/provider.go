@@ -13,10 +13,14 @@ import (
 	"github.com/volcengine/key-proxy/common"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/volcengine/key-proxy/internal/base"
-	"github.com/volcengine/key-proxy/internal/config"
+	"github.com/volcengine/key-proxy/internal/secret"
+	"github.com/volcengine/key-proxy/internal/tracing"
 	"github.com/volcengine/key-proxy/internal/utils/logs"
 )
 
@@ -30,24 +34,98 @@ func RegisterProvider(vendor string, f RegisterFunc) {
 
 type IProviderService interface {
 	ReformRequest(ctx context.Context, req *http.Request)
+	RefreshSecrets(ctx context.Context) error
+	RefreshRoleSessions(ctx context.Context) error
+	ProxyCredentialExpiries() []ProxyCredentialExpiry
+	SelfTest(ctx context.Context) []SelfTestResult
+	Accounts() []AccountInfo
+	DisableAccount(name string, until time.Time, reason string) error
+	EnableAccount(name string) bool
 }
 
 type IProvider interface {
 	ValidateRequest(ctx context.Context, req *http.Request) (context.Context, bool, error)
 	ResignRequest(ctx context.Context, req *http.Request) error
+	// Operation extracts the vendor API called by the request, it is called after ValidateRequest.
+	Operation(ctx context.Context, req *http.Request) Operation
 	String() string
 }
 
 type ImplProviderService struct {
-	endpointProviders map[string]IProvider
+	conf              *common.Config // the config which the providers are built from
+	mu                sync.RWMutex
+	endpointProviders map[string]*endpointProvider
+	replayGuard       *replayGuard
+	resolver          *secret.Resolver
+	evidenceStore     *evidenceStore
+	maxAge            time.Duration // max age of the proxy credentials
+	stsClient         *http.Client
+}
+
+// endpointProvider binds the provider with the configuration of its cloud account.
+type endpointProvider struct {
+	IProvider                      // provider of the first proxy credential
+	candidates   []*proxyCandidate // providers of all proxy credentials
+	endpoint     common.Endpoint
+	credentials  common.Credentials // credentials resolved from the secret sources
+	session      *RoleSession       // temporary credential which replaces the real credential
+	allowedHosts []string
+}
+
+func newEndpointProvider(registerFunc RegisterFunc, endpoint common.Endpoint, credentials common.Credentials, allowedHosts []string,
+	maxAge time.Duration, session *RoleSession) *endpointProvider {
+	signing := credentials
+	if session != nil {
+		signing.Real = session.Credential
+	}
+	candidates := newProxyCandidates(registerFunc, signing, maxAge)
+	// the secrets are masked wherever they appear in the logs, the hook payloads and the error responses
+	secrets := append(base.CredentialSecrets(credentials.Real), base.CredentialSecrets(signing.Real)...)
+	for _, candidate := range candidates {
+		secrets = append(secrets, base.CredentialSecrets(candidate.credential.Credential)...)
+	}
+	base.AddKnownSecrets(secrets...)
+	return &endpointProvider{
+		IProvider:    candidates[0].IProvider,
+		candidates:   candidates,
+		endpoint:     endpoint,
+		credentials:  credentials,
+		session:      session,
+		allowedHosts: allowedHosts,
+	}
 }
 
 // New registers cloud vendor providers to the service.
-func New(endpoints []common.Endpoint) (*ImplProviderService, error) {
+func New(conf *common.Config) (*ImplProviderService, error) {
 	s := &ImplProviderService{
-		endpointProviders: make(map[string]IProvider, 10),
+		conf:              conf,
+		endpointProviders: make(map[string]*endpointProvider, 10),
+		replayGuard:       newReplayGuard(conf.Replay),
+		resolver:          secret.NewResolver(conf.Secrets),
+		maxAge:            time.Duration(conf.Expiry.MaxAge) * 24 * time.Hour,
+		stsClient:         &http.Client{Timeout: stsTimeout},
 	}
-	for _, endpoint := range endpoints {
+	ctx := context.Background()
+	forbidden := conf.Forbidden
+	for name, rule := range map[string]common.ForbiddenRule{
+		"AccountNotFound":    forbidden.AccountNotFound,
+		"ProxyCredentialErr": forbidden.ProxyCredentialErr,
+		"Policy":             forbidden.Policy,
+		"ClientIP":           forbidden.ClientIP,
+	} {
+		if err := base.ValidateRuleMode(rule.Mode); err != nil {
+			return nil, fmt.Errorf("invalid Forbidden.%s: %v", name, err)
+		}
+	}
+	if forbidden.Policy.Mode == base.ModeQuarantine || forbidden.ClientIP.Mode == base.ModeQuarantine {
+		return nil, errors.New("quarantine mode is only supported by Forbidden.AccountNotFound and Forbidden.ProxyCredentialErr")
+	}
+	evidenceStore, err := newEvidenceStore(conf.Quarantine)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Quarantine: %v", err)
+	}
+	s.evidenceStore = evidenceStore
+	for _, endpoint := range conf.Endpoints {
 		if endpoint.CloudAccountName == "" {
 			return nil, errors.New("the name of cloud account cannot be empty")
 		}
@@ -59,19 +137,79 @@ func New(endpoints []common.Endpoint) (*ImplProviderService, error) {
 			}
 			return nil, fmt.Errorf("unknown vendor code: \"%s\", available vendor codes are: [%s]", endpoint.Vendor, strings.Join(availableVendorCodes, ", "))
 		}
-		provider := registerFunc(endpoint.Credentials)
+		credentials, err := s.resolver.ResolveCredentials(ctx, endpoint.Credentials)
+		if err != nil {
+			return nil, fmt.Errorf("cloud account %s: %v", endpoint.CloudAccountName, err)
+		}
 		// duplicated cloud account name is forbidden
 		_, existed := s.endpointProviders[endpoint.CloudAccountName]
 		if existed {
 			return nil, fmt.Errorf("cloud account has existed, duplicated name: %s", endpoint.CloudAccountName)
 		}
+		allowedHosts := endpoint.AllowedHosts
+		if len(allowedHosts) == 0 {
+			allowedHosts = defaultHosts[endpoint.Vendor]
+		}
+		session, err := s.assumeRole(ctx, endpoint, credentials)
+		if err != nil {
+			return nil, fmt.Errorf("cloud account %s: %v", endpoint.CloudAccountName, err)
+		}
+		provider := newEndpointProvider(registerFunc, endpoint, credentials, allowedHosts, s.maxAge, session)
 		s.endpointProviders[endpoint.CloudAccountName] = provider
-		logs.CtxInfo(context.Background(), "loaded %s provider with cloud account (name: %v) successfully", endpoint.Vendor, endpoint.CloudAccountName)
+		if s.maxAge > 0 {
+			for _, candidate := range provider.candidates {
+				if candidate.credential.CreatedAt.IsZero() {
+					logs.CtxWarn(ctx, "cloud account %s: proxy credential %s has no CreatedAt, Expiry.MaxAge does not apply to it", endpoint.CloudAccountName, candidate.name)
+				}
+			}
+		}
+		if conf.Replay.Enabled && replayExemptVendors[endpoint.Vendor] {
+			logs.CtxWarn(ctx, "cloud account %s: the signatures of %s carry no signing time, its requests are not checked for replays", endpoint.CloudAccountName, endpoint.Vendor)
+		}
+		logs.CtxInfo(ctx, "loaded %s provider with cloud account (name: %v) successfully", endpoint.Vendor, endpoint.CloudAccountName)
 	}
 
 	return s, nil
 }
 
+// RefreshSecrets resolves the credentials from the secret sources again, and rebuilds the providers whose
+// credentials have been rotated. Providers keep their old credentials if the sources are unavailable.
+func (s *ImplProviderService) RefreshSecrets(ctx context.Context) error {
+	s.mu.RLock()
+	current := make([]*endpointProvider, 0, len(s.endpointProviders))
+	for _, provider := range s.endpointProviders {
+		current = append(current, provider)
+	}
+	s.mu.RUnlock()
+
+	var errs []string
+	for _, provider := range current {
+		endpoint := provider.endpoint
+		credentials, err := s.resolver.ResolveCredentials(ctx, endpoint.Credentials)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("cloud account %s: %v", endpoint.CloudAccountName, err))
+			continue
+		}
+		if reflect.DeepEqual(credentials, provider.credentials) {
+			continue
+		}
+		// the temporary credential was got with the old real credential, which may have been revoked
+		session := provider.session
+		if !reflect.DeepEqual(credentials.Real, provider.credentials.Real) || credentials.AssumeRole != provider.credentials.AssumeRole {
+			if session, err = s.assumeRole(ctx, endpoint, credentials); err != nil {
+				errs = append(errs, fmt.Sprintf("cloud account %s: %v", endpoint.CloudAccountName, err))
+				continue
+			}
+		}
+		s.replaceEndpointProvider(provider, newEndpointProvider(providers[endpoint.Vendor], endpoint, credentials, provider.allowedHosts, s.maxAge, session))
+		logs.CtxInfo(ctx, "credentials of cloud account (name: %v) have been rotated", endpoint.CloudAccountName)
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 // reformRequest reverts request to the normal request to cloud vendors.
 func (s *ImplProviderService) reformRequest(req *http.Request) error {
 	originUri := req.Header.Get(base.OriginUrlKey)
@@ -116,38 +254,124 @@ func (s *ImplProviderService) reformRequest(req *http.Request) error {
 func (s *ImplProviderService) ReformRequest(ctx context.Context, req *http.Request) {
 	cloudAccountName := req.Header.Get(base.CloudAccountNameKey)
 	provider, found := s.getEndpointProvider(cloudAccountName)
+	ctx, span := tracing.Start(ctx, "ReformRequest", tracing.SpanKindInternal)
+	defer span.End()
+	span.SetAttribute("mcdn.cloud_account", cloudAccountName)
+	if found {
+		span.SetAttribute("mcdn.vendor", provider.endpoint.Vendor)
+	}
+
+	conf := s.conf
+	forbidden := conf.Forbidden
+	if !found {
+		mode := base.RuleMode(forbidden.AccountNotFound, forbidden.ForbiddenAccountNotFound, base.ModeOff)
+		exception := base.CloudAccountNotFound.WithRawError(fmt.Errorf("cloud account is not found, name: %s", cloudAccountName))
+		if mode == base.ModeQuarantine {
+			s.quarantine(ctx, req, req.Header.Get(base.VendorNameKey), cloudAccountName, QuarantineInvalidAccessKey, exception)
+		}
+		base.Enforce(ctx, mode, exception)
+	}
 
-	forbidden := config.Conf.Forbidden
-	if !found && forbidden.ForbiddenAccountNotFound {
-		panic(base.CloudAccountNotFound.WithRawError(fmt.Errorf("cloud account is not found, name: %s", cloudAccountName)))
+	if found {
+		if disabled, ok := sharedDisabledAccounts.get(cloudAccountName, time.Now()); ok {
+			panic(base.CloudAccountDisabled.WithRawError(fmt.Errorf("cloud account %s is disabled since %s: %s",
+				cloudAccountName, disabled.Since.Format(time.RFC3339), disabled.Reason)))
+		}
 	}
 
+	vendor := req.Header.Get(base.VendorNameKey)
 	err := s.reformRequest(req)
 	if err != nil {
 		panic(base.ReformRequestInternalErr.WithRawError(err))
 	}
 
-	// skip validation and resign, forward the request directly if provider was not found
+	// skip validation and resign, forward the request directly if provider was not found,
+	// but only to the default hosts of the vendor, so that the proxy is not an open relay
 	if provider == nil {
+		hosts := defaultHosts[vendor]
+		if len(hosts) == 0 {
+			panic(base.UpstreamHostForbidden.WithRawError(fmt.Errorf("cloud account %s is not found and vendor %q has no default hosts",
+				cloudAccountName, vendor)))
+		}
+		enforceUpstream(ctx, req.URL, hosts, conf.Upstream.AllowPrivateNetwork, fmt.Sprintf("[%s:%s]", vendor, cloudAccountName))
 		return
 	}
-	ctx, ok, err := provider.ValidateRequest(ctx, req)
+	// never sign requests to hosts that do not belong to the vendor
+	enforceUpstream(ctx, req.URL, provider.allowedHosts, conf.Upstream.AllowPrivateNetwork, fmt.Sprintf("[%s]", provider.String()))
+	now := time.Now()
+	_, validateSpan := tracing.Start(ctx, "validate", tracing.SpanKindInternal)
+	ctx, candidate, ok, err := provider.validate(ctx, req, now)
+	if candidate != nil {
+		validateSpan.SetAttribute("key_proxy.proxy_credential", candidate.name)
+	}
+	validateSpan.SetError(err)
+	if err == nil && !ok {
+		validateSpan.SetError(errors.New("proxy ak or sk is wrong"))
+	}
+	validateSpan.End()
+	if err != nil || !ok {
+		validationFailures.WithLabelValues(provider.endpoint.Vendor, cloudAccountName).Inc()
+	}
 	if err != nil {
 		panic(base.ValidateCredentialInternalErr.WithRawError(err))
 	}
-	if !ok && forbidden.ForbiddenProxyCredentialErr {
-		panic(base.ValidateCredentialErr.WithRawError(fmt.Errorf("[%s] proxy ak or sk is wrong", provider.String())))
+	if ok && candidate.expired(now) {
+		panic(base.ProxyCredentialExpired.WithRawError(fmt.Errorf("[%s] proxy credential %s of cloud account %s expired at %s",
+			provider.String(), candidate.name, cloudAccountName, candidate.notAfter.Format(time.RFC3339))))
+	}
+	if !ok {
+		mode := base.RuleMode(forbidden.ProxyCredentialErr, forbidden.ForbiddenProxyCredentialErr, base.ModeOff)
+		exception := base.ValidateCredentialErr.WithRawError(fmt.Errorf("[%s] proxy ak or sk is wrong", provider.String()))
+		if mode == base.ModeQuarantine {
+			s.quarantine(ctx, req, provider.endpoint.Vendor, cloudAccountName, QuarantineSignatureMismatch, exception)
+		}
+		base.Enforce(ctx, mode, exception)
 	}
 	if ok {
+		state := base.GetRequestState(ctx)
+		state.SetProxyCredential(candidate.name, candidate.credential.AccessKey)
+		// reject stale or replayed requests before the real credentials are used
+		// requests without the signature information fail the check, unless the vendor is exempt
+		signature, _ := GetRequestSignature(ctx)
+		if exception, err := s.replayGuard.Check(cloudAccountName, provider.endpoint.Vendor, signature); err != nil {
+			panic(exception.WithRawError(fmt.Errorf("[%s] %v", provider.String(), err)))
+		}
+		// only the approved operations can be called with the real credentials
+		operation := candidate.Operation(ctx, req)
+		state.SetOperation(operation.String())
+		policyMode := base.RuleMode(forbidden.Policy, false, base.ModeEnforce)
+		if err := checkPolicy(provider.endpoint.Policy, operation); err != nil {
+			base.Enforce(ctx, policyMode, base.OperationForbidden.WithRawError(fmt.Errorf("[%s] %v", provider.String(), err)))
+		}
+		if provider.endpoint.ReadOnly && !operation.IsReadOnly() {
+			base.Enforce(ctx, policyMode, base.ReadOnlyAccount.WithRawError(fmt.Errorf("[%s] operation %s may change the resources of the read-only cloud account %s",
+				provider.String(), operation, provider.endpoint.CloudAccountName)))
+		}
 		// resign the request, if this request was valid
-		err = provider.ResignRequest(ctx, req)
+		_, resignSpan := tracing.Start(ctx, "resign", tracing.SpanKindInternal)
+		err = candidate.ResignRequest(ctx, req)
+		resignSpan.SetError(err)
+		resignSpan.End()
 		if err != nil {
+			resignErrors.WithLabelValues(provider.endpoint.Vendor, cloudAccountName).Inc()
 			panic(base.ResignInternalErr.WithRawError(err))
 		}
+		state.SetResigned()
+	}
+}
+
+// replaceEndpointProvider replaces the provider unless it has been replaced by another refresh.
+func (s *ImplProviderService) replaceEndpointProvider(old, refreshed *endpointProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.endpointProviders[old.endpoint.CloudAccountName] == old {
+		s.endpointProviders[old.endpoint.CloudAccountName] = refreshed
 	}
 }
 
-func (s *ImplProviderService) getEndpointProvider(cloudAccountName string) (IProvider, bool) {
+func (s *ImplProviderService) getEndpointProvider(cloudAccountName string) (*endpointProvider, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	provider, ok := s.endpointProviders[cloudAccountName]
 	if !ok {
 		return nil, false
@@ -10,9 +10,11 @@ import (
 	"context"
 	"errors"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const (
@@ -24,6 +26,13 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &qiniuProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.qiniu.com", "*.qiniuapi.com")
+	provider.RegisterProbeHosts(vendorName, "api.qiniu.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	// QBox signatures carry no signing time, so the requests cannot be checked for replays
+	provider.RegisterReplayExempt(vendorName)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{Headers: []string{"Authorization"}})
 }
 
 type qiniuProvider struct {
@@ -56,3 +65,31 @@ func (s *qiniuProvider) ResignRequest(ctx context.Context, req *http.Request) er
 	req.Header.Set(signatureHeaderKey, "QBox "+sign)
 	return nil
 }
+
+func (s *qiniuProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	return provider.RestOperation(provider.HostService(req.URL.Hostname()), req)
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *qiniuProvider) ProxyAccessKey(req *http.Request) string {
+	// QBox {accessKey}:{signature}
+	authorization := strings.TrimPrefix(req.Header.Get(signatureHeaderKey), "QBox ")
+	if index := strings.Index(authorization, ":"); index >= 0 {
+		return authorization[:index]
+	}
+	return ""
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://api.qiniu.com/domain?limit=1", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(signatureHeaderKey, "QBox "+credential.AccessKey+":selftest")
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the APIs of Qiniu, which do not tell the bad tokens apart.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	return provider.JSONResponse(http.StatusUnauthorized, map[string]string{"error": "bad token"})
+}
@@ -0,0 +1,227 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const (
+	defaultQuarantineDir  = "./output/quarantine"
+	defaultMaxBodySize    = 64 * 1024
+	defaultMaxEvidences   = 10000
+	evidenceFileExtension = ".json"
+)
+
+// Evidence is the redacted record of a quarantined request.
+type Evidence struct {
+	Id               string
+	Time             time.Time
+	Code             string
+	Reason           string
+	CloudAccountName string
+	RemoteAddr       string
+	Method           string
+	Url              string
+	Header           http.Header
+	Body             string
+	BodyTruncated    bool
+}
+
+// QuarantineReason is the reason of a quarantined request told to the client.
+type QuarantineReason int
+
+const (
+	QuarantineInvalidAccessKey QuarantineReason = iota
+	QuarantineSignatureMismatch
+)
+
+// QuarantineResponse renders the error of the vendor for the quarantined requests, so that the clients cannot tell
+// them from the requests rejected by the vendor. requestId is the evidence id, shown as the request id of the vendor.
+type QuarantineResponse func(reason QuarantineReason, requestId string) base.VendorResponse
+
+var quarantineResponses = map[string]QuarantineResponse{}
+
+// RegisterQuarantineResponse registers the error of the vendor for the quarantined requests, the vendors without it
+// respond with Proxy.RequestQuarantined.
+func RegisterQuarantineResponse(vendor string, response QuarantineResponse) {
+	quarantineResponses[vendor] = response
+}
+
+// evidenceStore writes the evidences of the quarantined requests into a directory, one file per request. Once
+// maxEvidences is reached, the oldest evidences are removed for the new ones.
+type evidenceStore struct {
+	dir          string
+	maxBodySize  int
+	maxEvidences int
+
+	mu    sync.Mutex
+	files []string // the evidence files, oldest first
+}
+
+func newEvidenceStore(conf common.Quarantine) (*evidenceStore, error) {
+	store := &evidenceStore{
+		dir:          conf.Dir,
+		maxBodySize:  conf.MaxBodySize,
+		maxEvidences: conf.MaxEvidences,
+	}
+	if store.dir == "" {
+		store.dir = defaultQuarantineDir
+	}
+	if store.maxBodySize <= 0 {
+		store.maxBodySize = defaultMaxBodySize
+	}
+	if store.maxEvidences <= 0 {
+		store.maxEvidences = defaultMaxEvidences
+	}
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), evidenceFileExtension) {
+			store.files = append(store.files, file.Name())
+		}
+	}
+	return store, nil
+}
+
+// Record writes the redacted request as an evidence and returns its id.
+func (s *evidenceStore) Record(req *http.Request, cloudAccountName string, exception base.Exception) (string, error) {
+	id, err := newEvidenceId()
+	if err != nil {
+		return "", err
+	}
+	evidence := Evidence{
+		Id:               id,
+		Time:             time.Now(),
+		Code:             exception.Code,
+		Reason:           base.RedactText(exception.RawError),
+		CloudAccountName: cloudAccountName,
+		RemoteAddr:       req.RemoteAddr,
+		Method:           req.Method,
+		Url:              base.RedactURL(req.URL),
+		Header:           base.RedactHeader(req.Header),
+	}
+	evidence.Body, evidence.BodyTruncated, err = s.readBody(req)
+	if err != nil {
+		return id, err
+	}
+	data := new(bytes.Buffer)
+	encoder := json.NewEncoder(data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(evidence); err != nil {
+		return id, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.evict(); err != nil {
+		return id, err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return id, err
+	}
+	name := id + evidenceFileExtension
+	if err := ioutil.WriteFile(filepath.Join(s.dir, name), data.Bytes(), 0600); err != nil {
+		return id, err
+	}
+	s.files = append(s.files, name)
+	return id, nil
+}
+
+// evict removes the oldest evidences until there is room for a new one, the files removed by others are skipped.
+func (s *evidenceStore) evict() error {
+	for len(s.files) >= s.maxEvidences {
+		if err := os.Remove(filepath.Join(s.dir, s.files[0])); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("evict evidence %s failed: %v", s.files[0], err)
+		}
+		s.files = s.files[1:]
+	}
+	return nil
+}
+
+// readBody reads at most maxBodySize bytes of the body, and restores the body of the request.
+func (s *evidenceStore) readBody(req *http.Request) (string, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", false, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(s.maxBodySize)+1))
+	if err != nil {
+		return "", false, err
+	}
+	req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	truncated := len(body) > s.maxBodySize
+	if truncated {
+		body = body[:s.maxBodySize]
+	}
+	if truncated {
+		return base.RedactText(string(body)), true, nil
+	}
+	return base.RedactBody(req.Header.Get("Content-Type"), body), false, nil
+}
+
+// newEvidenceId generates a random UUID, which looks like the request ids of the vendors.
+func newEvidenceId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	id := hex.EncodeToString(b)
+	return id[:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:], nil
+}
+
+// quarantine records the request violating the rule into the evidence store, then rejects it with the error of the
+// vendor, which does not reveal that the request is rejected by the proxy. The evidence id is the request id of it.
+func (s *ImplProviderService) quarantine(ctx context.Context, req *http.Request, vendor, cloudAccountName string, reason QuarantineReason, exception base.Exception) {
+	id, err := s.evidenceStore.Record(req, cloudAccountName, exception)
+	if err != nil {
+		logs.CtxError(ctx, "[Quarantine] record evidence failed: %v", err)
+	}
+	logs.CtxWarn(ctx, "[Quarantine] request is quarantined, evidence id: %s, reason: %v", id, exception)
+	quarantined := base.RequestQuarantined.WithRawErrorStr(fmt.Sprintf("evidence id: %s", id))
+	if response, found := quarantineResponses[vendor]; found {
+		quarantined = quarantined.WithResponse(response(reason, id))
+	}
+	panic(quarantined)
+}
+
+// JSONResponse renders the error of the vendor as JSON.
+func JSONResponse(statusCode int, body interface{}) base.VendorResponse {
+	data, _ := json.Marshal(body)
+	return base.VendorResponse{StatusCode: statusCode, ContentType: "application/json", Body: data}
+}
+
+// XMLResponse renders the error of the vendor as XML.
+func XMLResponse(statusCode int, body string) base.VendorResponse {
+	return base.VendorResponse{StatusCode: statusCode, ContentType: "text/xml", Body: []byte(xml.Header + body)}
+}
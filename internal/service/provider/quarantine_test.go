@@ -0,0 +1,167 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+)
+
+func readEvidence(t *testing.T, dir, id string) Evidence {
+	data, err := ioutil.ReadFile(filepath.Join(dir, id+evidenceFileExtension))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evidence Evidence
+	if err = json.Unmarshal(data, &evidence); err != nil {
+		t.Fatal(err)
+	}
+	return evidence
+}
+
+func TestEvidenceStoreRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newEvidenceStore(common.Quarantine{Dir: dir, MaxBodySize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name      string
+		body      string
+		recorded  string
+		truncated bool
+	}{
+		{"empty body", "", "", false},
+		{"short body", "a=1&b=2", "a=1&b=2", false},
+		{"long body", "0123456789abcdef", "01234567", true},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "https://cdn.volcengineapi.com/?Action=ListCdnDomains", strings.NewReader(c.body))
+		req.Header.Set("Authorization", "HMAC-SHA256 Credential=ak/20230101, Signature=secret-signature")
+		exception := base.CloudAccountNotFound.WithRawError(errors.New("cloud account is not found"))
+		id, err := store.Record(req, "acc", exception)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+			t.Errorf("%s: evidence id %s is not a UUID", c.name, id)
+		}
+		evidence := readEvidence(t, dir, id)
+		if evidence.Id != id || evidence.Code != exception.Code || evidence.CloudAccountName != "acc" || evidence.Method != "POST" {
+			t.Errorf("%s: evidence is %+v", c.name, evidence)
+		}
+		if strings.Contains(evidence.Header.Get("Authorization"), "secret-signature") {
+			t.Errorf("%s: authorization is not redacted: %s", c.name, evidence.Header.Get("Authorization"))
+		}
+		if evidence.Body != c.recorded || evidence.BodyTruncated != c.truncated {
+			t.Errorf("%s: body is %q (truncated: %v), want %q (truncated: %v)", c.name, evidence.Body, evidence.BodyTruncated, c.recorded, c.truncated)
+		}
+		// the request can still be read as a whole
+		if body, _ := ioutil.ReadAll(req.Body); string(body) != c.body {
+			t.Errorf("%s: body is %q after recording, want %q", c.name, body, c.body)
+		}
+	}
+}
+
+func TestEvidenceStoreEviction(t *testing.T) {
+	dir := t.TempDir()
+	// evidences left by the last run are evicted first, oldest first
+	for i, name := range []string{"old-2", "old-1"} {
+		path := filepath.Join(dir, name+evidenceFileExtension)
+		if err := ioutil.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := newEvidenceStore(common.Quarantine{Dir: dir, MaxEvidences: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := store.Record(httptest.NewRequest("GET", "/", nil), "acc", base.ValidateCredentialErr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := map[string]bool{ids[1] + evidenceFileExtension: true, ids[2] + evidenceFileExtension: true, "other.txt": true}
+	if len(names) != len(want) {
+		t.Fatalf("files are %v, want the last 2 evidences and other.txt", names)
+	}
+	for _, name := range names {
+		if !want[name] {
+			t.Errorf("file %s is not evicted", name)
+		}
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	RegisterQuarantineResponse("test-quarantine", func(reason QuarantineReason, requestId string) base.VendorResponse {
+		return JSONResponse(401, map[string]interface{}{"Reason": reason, "RequestId": requestId})
+	})
+	defer delete(quarantineResponses, "test-quarantine")
+	dir := t.TempDir()
+	store, err := newEvidenceStore(common.Quarantine{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ImplProviderService{evidenceStore: store}
+	cases := []struct {
+		vendor   string
+		response bool
+	}{
+		{"test-quarantine", true},
+		{"test-without-response", false},
+	}
+	for _, c := range cases {
+		func() {
+			defer func() {
+				exception, ok := recover().(base.Exception)
+				if !ok || exception.Code != base.RequestQuarantined.Code {
+					t.Fatalf("%s: recovered %v, want %s", c.vendor, exception, base.RequestQuarantined.Code)
+				}
+				id := strings.TrimPrefix(exception.RawError, "evidence id: ")
+				readEvidence(t, dir, id)
+				if (exception.Response != nil) != c.response {
+					t.Fatalf("%s: vendor response is %v", c.vendor, exception.Response)
+				}
+				if c.response && !strings.Contains(string(exception.Response.Body), `"RequestId":"`+id+`"`) {
+					t.Errorf("%s: the request id of the response is not the evidence id: %s", c.vendor, exception.Response.Body)
+				}
+			}()
+			req := httptest.NewRequest("GET", "/", nil)
+			s.quarantine(context.Background(), req, c.vendor, "acc", QuarantineSignatureMismatch, base.ValidateCredentialErr)
+		}()
+	}
+}
@@ -0,0 +1,340 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/service/provider"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/akamai"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/aliyun"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/aws"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/baidu"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/baishan"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/huawei"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/jingdong"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/ksyun"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/qiniu"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/tencent"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/ucloud"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/volcengine"
+	_ "github.com/volcengine/key-proxy/internal/service/provider/wangsu"
+	"github.com/volcengine/key-proxy/internal/utils"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+// bufferLogger keeps the logs, so that the tests can check what is logged.
+type bufferLogger struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *bufferLogger) log(template string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(&l.buf, template+"\n", args...)
+}
+
+// reset returns the logs and clears them.
+func (l *bufferLogger) reset() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.buf.Reset()
+	return l.buf.String()
+}
+
+func (l *bufferLogger) CtxDebug(ctx context.Context, template string, args ...interface{}) {
+	l.log(template, args...)
+}
+
+func (l *bufferLogger) CtxInfo(ctx context.Context, template string, args ...interface{}) {
+	l.log(template, args...)
+}
+
+func (l *bufferLogger) CtxWarn(ctx context.Context, template string, args ...interface{}) {
+	l.log(template, args...)
+}
+
+func (l *bufferLogger) CtxError(ctx context.Context, template string, args ...interface{}) {
+	l.log(template, args...)
+}
+
+func (l *bufferLogger) CtxFatal(ctx context.Context, template string, args ...interface{}) {
+	l.log(template, args...)
+}
+
+var logger = &bufferLogger{}
+
+func init() {
+	logs.MustInit(logger)
+}
+
+// signatureFunc extracts the signatures from a request signed by the vendor.
+type signatureFunc func(req *http.Request) []string
+
+// headerSignature extracts the first group of the pattern from the Authorization header.
+func headerSignature(pattern string) signatureFunc {
+	re := regexp.MustCompile(pattern)
+	return func(req *http.Request) []string {
+		if match := re.FindStringSubmatch(req.Header.Get("Authorization")); len(match) > 1 {
+			return []string{match[1]}
+		}
+		return nil
+	}
+}
+
+func querySignature(key string) signatureFunc {
+	return func(req *http.Request) []string {
+		return []string{req.URL.Query().Get(key)}
+	}
+}
+
+func formSignature(key string) signatureFunc {
+	return func(req *http.Request) []string {
+		body, err := utils.CopyRequestBody(req)
+		if err != nil {
+			return nil
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		return []string{form.Get(key)}
+	}
+}
+
+// basicSignature extracts the basic credential and the signature encoded in it as "access key:signature".
+func basicSignature(req *http.Request) []string {
+	encoded := strings.TrimPrefix(req.Header.Get("Authorization"), "Basic ")
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	return []string{encoded, string(decoded[bytes.IndexByte(decoded, ':')+1:])}
+}
+
+// tokenSignature is for the vendors whose clients send the access token instead of signing.
+func tokenSignature(req *http.Request) []string {
+	return nil
+}
+
+var vendorSignatures = []struct {
+	vendor    string
+	signature signatureFunc
+}{
+	{"akamai", headerSignature(`signature=([^;]+)`)},
+	{"aliyun", querySignature("Signature")},
+	{"aws", headerSignature(`Signature=([0-9a-f]+)`)},
+	{"baidu", headerSignature(`/([0-9a-f]{64})$`)},
+	{"baishan", tokenSignature},
+	{"huawei", headerSignature(`Signature=([0-9a-f]+)`)},
+	{"jingdong", headerSignature(`Signature=([0-9a-f]+)`)},
+	{"ksyun", headerSignature(`Signature=([0-9a-f]+)`)},
+	{"qiniu", headerSignature(`:(\S+)$`)},
+	{"tencent", headerSignature(`Signature=([0-9a-f]+)`)},
+	{"ucloud", formSignature("Signature")},
+	{"volcengine", headerSignature(`Signature=([0-9a-f]+)`)},
+	{"wangsu", basicSignature},
+}
+
+func testCredential(prefix, vendor string) common.Credential {
+	return common.Credential{
+		AccessKey:    "AK" + strings.ToUpper(prefix),
+		SecretKey:    prefix + "-secret-key-" + vendor,
+		AccessToken:  prefix + "-access-token-" + vendor,
+		ClientToken:  prefix + "-client-token-" + vendor,
+		ClientSecret: prefix + "-client-secret-" + vendor,
+	}
+}
+
+// assertRedacted fails if any of the secrets appears in the text, as is or escaped in urls.
+func assertRedacted(t *testing.T, where, text string, secrets []string) {
+	t.Helper()
+	if text == "" {
+		t.Errorf("%s is empty", where)
+	}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		if strings.Contains(text, secret) || strings.Contains(text, url.QueryEscape(secret)) {
+			t.Errorf("%s leaks %q:\n%s", where, secret, text)
+		}
+	}
+}
+
+func dumpRequest(t *testing.T, req *http.Request) string {
+	t.Helper()
+	dump, err := httputil.DumpRequest(req, true)
+	if err != nil {
+		t.Fatalf("dump request failed: %v", err)
+	}
+	return string(dump)
+}
+
+// platformRequest wraps the request of the client in the format of the platform.
+func platformRequest(t *testing.T, cloudAccountName string, req *http.Request) *http.Request {
+	t.Helper()
+	body, err := utils.CopyRequestBody(req)
+	if err != nil {
+		t.Fatalf("read body failed: %v", err)
+	}
+	wrapped, err := http.NewRequest(req.Method, "http://127.0.0.1:8888/", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("build request failed: %v", err)
+	}
+	keptHeaders := make([]string, 0, len(req.Header))
+	for key, values := range req.Header {
+		wrapped.Header[key] = values
+		keptHeaders = append(keptHeaders, key)
+	}
+	wrapped.Header.Set(base.CloudAccountNameKey, cloudAccountName)
+	wrapped.Header.Set(base.OriginUrlKey, req.URL.String())
+	wrapped.Header.Set(base.KeptHeaders, strings.Join(keptHeaders, ","))
+	return wrapped
+}
+
+func reform(service provider.IProviderService, req *http.Request) (exception base.Exception, ok bool) {
+	defer func() {
+		exception, ok = recover().(base.Exception)
+	}()
+	service.ReformRequest(req.Context(), req)
+	return exception, false
+}
+
+func TestRedaction(t *testing.T) {
+	covered := make(map[string]bool, len(vendorSignatures))
+	for _, tt := range vendorSignatures {
+		covered[tt.vendor] = true
+	}
+	for _, vendor := range provider.Vendors() {
+		if !covered[vendor] {
+			t.Errorf("vendor %s is not covered", vendor)
+		}
+	}
+
+	now := time.Now()
+	for _, tt := range vendorSignatures {
+		tt := tt
+		t.Run(tt.vendor, func(t *testing.T) {
+			proxy, real, wrong := testCredential("proxy", tt.vendor), testCredential("real", tt.vendor), testCredential("wrong", tt.vendor)
+			wrong.AccessKey = proxy.AccessKey
+			client, err := provider.SignSample(tt.vendor, proxy, now)
+			if err != nil {
+				t.Fatalf("sign the client request failed: %v", err)
+			}
+			forwarded, err := provider.SignSample(tt.vendor, real, now)
+			if err != nil {
+				t.Fatalf("sign the forwarded request failed: %v", err)
+			}
+			forged, err := provider.SignSample(tt.vendor, wrong, now)
+			if err != nil {
+				t.Fatalf("sign the forged request failed: %v", err)
+			}
+			var secrets []string
+			for _, credential := range []common.Credential{proxy, real, wrong} {
+				secrets = append(secrets, base.CredentialSecrets(credential)...)
+			}
+			for _, req := range []*http.Request{client, forwarded, forged} {
+				secrets = append(secrets, tt.signature(req)...)
+			}
+			// the unredacted request must carry some of the secrets, or the assertions below prove nothing
+			raw := dumpRequest(t, client)
+			found := false
+			for _, secret := range append(tt.signature(client), base.CredentialSecrets(proxy)...) {
+				found = found || (secret != "" && strings.Contains(raw, secret))
+			}
+			if !found {
+				t.Fatalf("no secret is found in the client request:\n%s", raw)
+			}
+
+			dir := t.TempDir()
+			conf := &common.Config{
+				Endpoints: []common.Endpoint{{
+					CloudAccountName: "acc_" + tt.vendor,
+					Vendor:           tt.vendor,
+					Credentials:      common.Credentials{Proxy: proxy, Real: real},
+					AllowedHosts:     []string{client.URL.Hostname()},
+				}},
+				Upstream:   common.Upstream{AllowPrivateNetwork: true},
+				Quarantine: common.Quarantine{Dir: dir},
+				Forbidden:  common.Forbidden{ProxyCredentialErr: common.ForbiddenRule{Mode: base.ModeQuarantine}},
+			}
+			service, err := provider.New(conf)
+			if err != nil {
+				t.Fatalf("create the providers failed: %v", err)
+			}
+			logger.reset()
+
+			for name, req := range map[string]*http.Request{"client": client, "forwarded": forwarded} {
+				before := dumpRequest(t, req)
+				assertRedacted(t, name+" DumpHttpRequest", base.DumpHttpRequest(req), secrets)
+
+				info := base.RedactBaseInfo(common.BaseInfo{Request: req, TargetUrl: req.URL.String()})
+				assertRedacted(t, name+" RedactBaseInfo request", dumpRequest(t, info.Request), secrets)
+				assertRedacted(t, name+" RedactBaseInfo target url", info.TargetUrl, secrets)
+				if after := dumpRequest(t, req); after != before {
+					t.Errorf("%s request is changed by the redaction:\n%s\n%s", name, before, after)
+				}
+
+				rawError := &url.Error{Op: req.Method, URL: req.URL.String(), Err: fmt.Errorf("sign with %s failed: %w", real.SecretKey, errors.New("connection refused"))}
+				detail := base.BuildErrorResponse(base.McdnArgs{}, base.NetworkErr.WithRawError(rawError)).ResponseMetadata.Error.Detail
+				assertRedacted(t, name+" BuildErrorResponse detail", detail, secrets)
+			}
+
+			exception, ok := reform(service, platformRequest(t, "acc_"+tt.vendor, forged))
+			if !ok || exception.Code != base.RequestQuarantined.Code {
+				t.Fatalf("the forged request is not quarantined: %+v", exception)
+			}
+			assertRedacted(t, "quarantine detail", base.BuildErrorResponse(base.McdnArgs{}, exception).ResponseMetadata.Error.Detail, secrets)
+			if exception.Response == nil {
+				t.Fatalf("the quarantined request is not responded in the format of %s", tt.vendor)
+			}
+			assertRedacted(t, "quarantine response", string(exception.Response.Body), secrets)
+			files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+			if err != nil || len(files) != 1 {
+				t.Fatalf("expect 1 evidence, got %v: %v", files, err)
+			}
+			evidence, err := ioutil.ReadFile(files[0])
+			if err != nil {
+				t.Fatalf("read the evidence failed: %v", err)
+			}
+			assertRedacted(t, "quarantine evidence", string(evidence), secrets)
+			assertRedacted(t, "logs", logger.reset(), secrets)
+		})
+	}
+}
+
+func TestRedactionKeepsRequest(t *testing.T) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "https://api.ucloud.cn/?Signature=abc",
+		strings.NewReader("Action=Describe&Signature=abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	base.RedactBaseInfo(common.BaseInfo{Request: req})
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil || string(body) != "Action=Describe&Signature=abc" || req.URL.Query().Get("Signature") != "abc" {
+		t.Errorf("the request is changed by the redaction: %q %s %v", body, req.URL, err)
+	}
+}
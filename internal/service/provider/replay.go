@@ -0,0 +1,154 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+)
+
+const (
+	defaultClockSkew      = 300
+	defaultNonceCacheSize = 100000
+	requestSignatureKey   = "RequestSignature"
+)
+
+// RequestSignature describes when and with which nonce a proxy-signed request was signed.
+type RequestSignature struct {
+	SignTime  time.Time
+	Nonce     string
+	Signature string
+}
+
+// WithRequestSignature stores the signature information of the request into the context,
+// providers call it in ValidateRequest so that the freshness of the request can be checked.
+func WithRequestSignature(ctx context.Context, signature RequestSignature) context.Context {
+	return context.WithValue(ctx, requestSignatureKey, signature)
+}
+
+// GetRequestSignature gets the signature information stored by WithRequestSignature.
+func GetRequestSignature(ctx context.Context) (RequestSignature, bool) {
+	signature, ok := ctx.Value(requestSignatureKey).(RequestSignature)
+	return signature, ok
+}
+
+// replayExemptVendors are the vendors whose signatures carry no signing time, so their requests cannot be checked.
+var replayExemptVendors = make(map[string]bool)
+
+// RegisterReplayExempt exempts the vendor from the replay check. The requests of the other vendors are rejected if
+// their signing time is missing, so only the vendors whose signatures carry no signing time should call it.
+func RegisterReplayExempt(vendor string) {
+	replayExemptVendors[vendor] = true
+}
+
+// ReplayExempt tells whether the requests of the vendor are not checked for replays.
+func ReplayExempt(vendor string) bool {
+	return replayExemptVendors[vendor]
+}
+
+// sharedNonceCache is shared by the replay guards of the provider services, so the seen nonces survive config
+// reloading.
+var sharedNonceCache = &nonceCache{
+	entries: make(map[string]*list.Element, 1024),
+	order:   list.New(),
+}
+
+// nonceCache remembers the nonces or signatures of recent requests in the order they were added.
+type nonceCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type replayEntry struct {
+	key      string
+	expireAt time.Time
+}
+
+// replayGuard rejects stale requests and the requests whose nonces or signatures are in the cache.
+type replayGuard struct {
+	*nonceCache
+	enabled   bool
+	clockSkew time.Duration
+	capacity  int
+}
+
+// newReplayGuard creates a guard with the config, it keeps the nonces remembered by the guards of the old configs.
+func newReplayGuard(conf common.Replay) *replayGuard {
+	clockSkew := conf.ClockSkew
+	if clockSkew <= 0 {
+		clockSkew = defaultClockSkew
+	}
+	capacity := conf.NonceCacheSize
+	if capacity <= 0 {
+		capacity = defaultNonceCacheSize
+	}
+	return &replayGuard{
+		nonceCache: sharedNonceCache,
+		enabled:    conf.Enabled,
+		clockSkew:  time.Duration(clockSkew) * time.Second,
+		capacity:   capacity,
+	}
+}
+
+// Check returns the exception and the error if the signing time is missing or out of the clock-skew window, the
+// nonce (or signature for vendors without nonce) has been seen in the window, or the cache is full of the nonces
+// which have not expired. A full cache fails closed, since forgetting a live nonce would allow replaying it.
+func (g *replayGuard) Check(cloudAccountName, vendor string, signature RequestSignature) (base.Exception, error) {
+	if !g.enabled || replayExemptVendors[vendor] {
+		return base.Exception{}, nil
+	}
+	if signature.SignTime.IsZero() {
+		return base.RequestExpired, fmt.Errorf("signing time is missing or cannot be parsed")
+	}
+	now := time.Now()
+	skew := now.Sub(signature.SignTime)
+	if skew > g.clockSkew || skew < -g.clockSkew {
+		return base.RequestExpired, fmt.Errorf("signing time %s is out of the allowed clock skew (%s)", signature.SignTime.Format(time.RFC3339), g.clockSkew)
+	}
+	key := signature.Nonce
+	if key == "" {
+		key = signature.Signature
+	}
+	if key == "" {
+		return base.RequestReplayed, fmt.Errorf("neither nonce nor signature is found")
+	}
+	key = cloudAccountName + "/" + key
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if elem, existed := g.entries[key]; existed {
+		if elem.Value.(*replayEntry).expireAt.After(now) {
+			return base.RequestReplayed, fmt.Errorf("request with the same nonce or signature has been seen before")
+		}
+		g.order.Remove(elem)
+		delete(g.entries, key)
+	}
+	// entries expire in the order they were added, so the expired ones are at the front
+	for elem := g.order.Front(); elem != nil; elem = g.order.Front() {
+		entry := elem.Value.(*replayEntry)
+		if entry.expireAt.After(now) {
+			break
+		}
+		g.order.Remove(elem)
+		delete(g.entries, entry.key)
+	}
+	if g.order.Len() >= g.capacity {
+		return base.ReplayCacheFull, fmt.Errorf("%d nonces or signatures are remembered, which have not expired", g.order.Len())
+	}
+	// the request would be stale after the sign time plus the clock skew, so it's safe to forget it then
+	g.entries[key] = g.order.PushBack(&replayEntry{
+		key:      key,
+		expireAt: now.Add(2 * g.clockSkew),
+	})
+	return base.Exception{}, nil
+}
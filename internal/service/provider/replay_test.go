@@ -0,0 +1,124 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+)
+
+// newTestReplayGuard creates a guard with its own cache, so that the tests do not share the nonces.
+func newTestReplayGuard(conf common.Replay) *replayGuard {
+	guard := newReplayGuard(conf)
+	guard.nonceCache = &nonceCache{entries: make(map[string]*list.Element), order: list.New()}
+	return guard
+}
+
+func TestReplayGuardFreshness(t *testing.T) {
+	guard := newTestReplayGuard(common.Replay{Enabled: true, ClockSkew: 60})
+	now := time.Now()
+	cases := []struct {
+		name      string
+		signature RequestSignature
+		exception base.Exception
+	}{
+		{"now", RequestSignature{SignTime: now, Nonce: "a"}, base.Exception{}},
+		{"within the past skew", RequestSignature{SignTime: now.Add(-50 * time.Second), Nonce: "b"}, base.Exception{}},
+		{"within the future skew", RequestSignature{SignTime: now.Add(50 * time.Second), Nonce: "c"}, base.Exception{}},
+		{"older than the skew", RequestSignature{SignTime: now.Add(-70 * time.Second), Nonce: "d"}, base.RequestExpired},
+		{"newer than the skew", RequestSignature{SignTime: now.Add(70 * time.Second), Nonce: "e"}, base.RequestExpired},
+		{"missing signing time", RequestSignature{Nonce: "f"}, base.RequestExpired},
+		{"neither nonce nor signature", RequestSignature{SignTime: now}, base.RequestReplayed},
+	}
+	for _, c := range cases {
+		exception, err := guard.Check("acc", "volcengine", c.signature)
+		if exception.Code != c.exception.Code {
+			t.Errorf("%s: exception is %q (%v), want %q", c.name, exception.Code, err, c.exception.Code)
+		}
+		if (err != nil) != (c.exception.Code != "") {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+	}
+}
+
+func TestReplayGuardNonces(t *testing.T) {
+	guard := newTestReplayGuard(common.Replay{Enabled: true, ClockSkew: 60})
+	now := time.Now()
+	cases := []struct {
+		name      string
+		account   string
+		signature RequestSignature
+		exception base.Exception
+	}{
+		{"first nonce", "acc", RequestSignature{SignTime: now, Nonce: "n1"}, base.Exception{}},
+		{"replayed nonce", "acc", RequestSignature{SignTime: now, Nonce: "n1"}, base.RequestReplayed},
+		{"same nonce of another account", "other", RequestSignature{SignTime: now, Nonce: "n1"}, base.Exception{}},
+		{"another nonce", "acc", RequestSignature{SignTime: now, Nonce: "n2"}, base.Exception{}},
+		{"first signature without nonce", "acc", RequestSignature{SignTime: now, Signature: "s1"}, base.Exception{}},
+		{"replayed signature without nonce", "acc", RequestSignature{SignTime: now, Signature: "s1"}, base.RequestReplayed},
+	}
+	for _, c := range cases {
+		exception, _ := guard.Check(c.account, "volcengine", c.signature)
+		if exception.Code != c.exception.Code {
+			t.Errorf("%s: exception is %q, want %q", c.name, exception.Code, c.exception.Code)
+		}
+	}
+}
+
+func TestReplayGuardExpiredNonces(t *testing.T) {
+	guard := newTestReplayGuard(common.Replay{Enabled: true, ClockSkew: 60, NonceCacheSize: 1})
+	signature := RequestSignature{SignTime: time.Now(), Nonce: "n1"}
+	if exception, err := guard.Check("acc", "volcengine", signature); err != nil {
+		t.Fatalf("first request: %s %v", exception.Code, err)
+	}
+	// the nonce is forgotten once it expires, which frees the cache
+	guard.order.Front().Value.(*replayEntry).expireAt = time.Now().Add(-time.Second)
+	if exception, err := guard.Check("acc", "volcengine", RequestSignature{SignTime: time.Now(), Nonce: "n2"}); err != nil {
+		t.Fatalf("request after the nonce expired: %s %v", exception.Code, err)
+	}
+	if _, existed := guard.entries["acc/n1"]; existed {
+		t.Errorf("expired nonce is still remembered")
+	}
+}
+
+func TestReplayGuardFullCache(t *testing.T) {
+	guard := newTestReplayGuard(common.Replay{Enabled: true, ClockSkew: 60, NonceCacheSize: 2})
+	now := time.Now()
+	for _, nonce := range []string{"n1", "n2"} {
+		if exception, err := guard.Check("acc", "volcengine", RequestSignature{SignTime: now, Nonce: nonce}); err != nil {
+			t.Fatalf("nonce %s: %s %v", nonce, exception.Code, err)
+		}
+	}
+	// a full cache of live nonces fails closed instead of forgetting them
+	exception, err := guard.Check("acc", "volcengine", RequestSignature{SignTime: now, Nonce: "n3"})
+	if exception.Code != base.ReplayCacheFull.Code || err == nil {
+		t.Errorf("exception is %q (%v), want %q", exception.Code, err, base.ReplayCacheFull.Code)
+	}
+	if exception, _ := guard.Check("acc", "volcengine", RequestSignature{SignTime: now, Nonce: "n1"}); exception.Code != base.RequestReplayed.Code {
+		t.Errorf("remembered nonce: exception is %q, want %q", exception.Code, base.RequestReplayed.Code)
+	}
+}
+
+func TestReplayGuardDisabled(t *testing.T) {
+	guard := newTestReplayGuard(common.Replay{Enabled: false})
+	signature := RequestSignature{Nonce: "n1"}
+	for i := 0; i < 2; i++ {
+		if exception, err := guard.Check("acc", "volcengine", signature); err != nil {
+			t.Errorf("disabled guard: %s %v", exception.Code, err)
+		}
+	}
+	RegisterReplayExempt("test-exempt")
+	defer delete(replayExemptVendors, "test-exempt")
+	guard = newTestReplayGuard(common.Replay{Enabled: true})
+	if exception, err := guard.Check("acc", "test-exempt", RequestSignature{}); err != nil {
+		t.Errorf("exempt vendor: %s %v", exception.Code, err)
+	}
+}
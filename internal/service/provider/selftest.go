@@ -0,0 +1,215 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+)
+
+const (
+	CheckOK      = "ok"
+	CheckFailed  = "fail"
+	CheckSkipped = "skipped"
+)
+
+var (
+	sampleRequests = make(map[string]SampleRequest, 12)
+	probeHosts     = make(map[string][]string, 12)
+)
+
+// SampleRequest builds a request to the vendor carrying a placeholder signature in the format of the vendor, which
+// ValidateRequest can parse. It must not send anything.
+type SampleRequest func(credential common.Credential, now time.Time) (*http.Request, error)
+
+// RegisterSampleRequest registers the sample request of the vendor, which the self test signs and validates.
+func RegisterSampleRequest(vendor string, sample SampleRequest) {
+	sampleRequests[vendor] = sample
+}
+
+// RegisterProbeHosts registers the API hosts of the vendor, which are checked for reachability if the endpoint
+// does not configure any AllowedHosts without wildcards.
+func RegisterProbeHosts(vendor string, hosts ...string) {
+	probeHosts[vendor] = append(probeHosts[vendor], hosts...)
+}
+
+// SelfTestResult is the result of the round trip of a proxy credential.
+type SelfTestResult struct {
+	CloudAccountName string
+	Vendor           string
+	ProxyCredential  string
+	Status           string
+	Message          string `json:",omitempty"`
+}
+
+// SelfTest signs the sample request of the vendor with each proxy credential, then validates it with the same
+// credential, so that a broken signer or validator is found before the clients call. The real credentials are not
+// used and nothing is sent to the vendors.
+func (s *ImplProviderService) SelfTest(ctx context.Context) []SelfTestResult {
+	s.mu.RLock()
+	current := make([]*endpointProvider, 0, len(s.endpointProviders))
+	for _, provider := range s.endpointProviders {
+		current = append(current, provider)
+	}
+	s.mu.RUnlock()
+
+	now := time.Now()
+	var results []SelfTestResult
+	for _, provider := range current {
+		endpoint := provider.endpoint
+		for _, candidate := range provider.candidates {
+			result := SelfTestResult{
+				CloudAccountName: endpoint.CloudAccountName,
+				Vendor:           endpoint.Vendor,
+				ProxyCredential:  candidate.name,
+				Status:           CheckOK,
+			}
+			sample, found := sampleRequests[endpoint.Vendor]
+			if !found {
+				result.Status = CheckSkipped
+				result.Message = "no sample request is registered by the vendor"
+			} else if err := roundTrip(ctx, providers[endpoint.Vendor], sample, candidate.credential.Credential, now); err != nil {
+				result.Status = CheckFailed
+				result.Message = err.Error()
+			} else if candidate.expired(now) {
+				// the signature is still checked, expired credentials are rejected later
+				result.Message = fmt.Sprintf("expired at %s", candidate.notAfter.Format(time.RFC3339))
+			}
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].CloudAccountName != results[j].CloudAccountName {
+			return results[i].CloudAccountName < results[j].CloudAccountName
+		}
+		return results[i].ProxyCredential < results[j].ProxyCredential
+	})
+	return results
+}
+
+// roundTrip parses the sample request, signs it with the credential as if it was the real one, then validates it.
+func roundTrip(ctx context.Context, registerFunc RegisterFunc, sample SampleRequest, credential common.Credential, now time.Time) (err error) {
+	defer func() {
+		// providers assume the requests are valid in places, a broken one must not crash the proxy
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	provider := registerFunc(common.Credentials{Proxy: credential, Real: credential})
+	req, err := sample(credential, now)
+	if err != nil {
+		return fmt.Errorf("build sample request failed: %v", err)
+	}
+	req = req.WithContext(ctx)
+	signCtx, _, err := provider.ValidateRequest(ctx, req)
+	if err != nil {
+		return fmt.Errorf("parse sample request failed: %v", err)
+	}
+	if err := provider.ResignRequest(signCtx, req); err != nil {
+		return fmt.Errorf("sign failed: %v", err)
+	}
+	_, ok, err := provider.ValidateRequest(ctx, req)
+	if err != nil {
+		return fmt.Errorf("validate failed: %v", err)
+	}
+	if !ok {
+		return errors.New("the signature is rejected by the validator of the same credential")
+	}
+	return nil
+}
+
+// ProbeResult is the reachability of an upstream host.
+type ProbeResult struct {
+	Host    string
+	Vendors []string
+	Status  string
+	Message string `json:",omitempty"`
+}
+
+// ProbeUpstreams resolves and connects to the upstream hosts of the endpoints concurrently. The hosts are the
+// AllowedHosts without wildcards, or the API hosts registered by the vendor.
+func ProbeUpstreams(ctx context.Context, endpoints []common.Endpoint, timeout time.Duration) []ProbeResult {
+	vendors := make(map[string][]string)
+	for _, endpoint := range endpoints {
+		for _, host := range upstreamHosts(endpoint) {
+			if !containsString(vendors[host], endpoint.Vendor) {
+				vendors[host] = append(vendors[host], endpoint.Vendor)
+			}
+		}
+	}
+	results := make([]ProbeResult, 0, len(vendors))
+	for host, hostVendors := range vendors {
+		sort.Strings(hostVendors)
+		results = append(results, ProbeResult{Host: host, Vendors: hostVendors, Status: CheckOK})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Host < results[j].Host
+	})
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(result *ProbeResult) {
+			defer wg.Done()
+			if err := probe(ctx, result.Host); err != nil {
+				result.Status = CheckFailed
+				result.Message = err.Error()
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+func upstreamHosts(endpoint common.Endpoint) []string {
+	var hosts []string
+	for _, pattern := range endpoint.AllowedHosts {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern != "" && !strings.Contains(pattern, "*") {
+			hosts = append(hosts, pattern)
+		}
+	}
+	if len(hosts) == 0 {
+		hosts = probeHosts[endpoint.Vendor]
+	}
+	return hosts
+}
+
+func probe(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolve failed: %v", err)
+	}
+	if len(addrs) == 0 {
+		return errors.New("resolve failed: no address")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0].IP.String(), "443"))
+	if err != nil {
+		return fmt.Errorf("connect failed: %v", err)
+	}
+	return conn.Close()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
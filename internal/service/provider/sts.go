@@ -0,0 +1,136 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const (
+	defaultRoleSessionName   = "key-proxy"
+	defaultRoleDuration      = 3600
+	defaultRoleRefreshBefore = 300
+	stsTimeout               = 10 * time.Second
+	maxSTSResponseSize       = 1 << 20
+)
+
+var roleAssumers = make(map[string]RoleAssumer, 4)
+
+// RoleSession is the temporary credential of an assumed role, the session token is kept in AccessToken.
+type RoleSession struct {
+	Credential common.Credential
+	Expiration time.Time
+}
+
+// RoleAssumer calls the STS service of the vendor to assume the role with the credential.
+type RoleAssumer func(ctx context.Context, client *http.Client, credential common.Credential, role common.AssumeRole) (RoleSession, error)
+
+// RegisterRoleAssumer registers the STS client of the vendor, the vendors without one do not support AssumeRole.
+func RegisterRoleAssumer(vendor string, assumer RoleAssumer) {
+	roleAssumers[vendor] = assumer
+}
+
+// RoleDefaults fills the defaults of the role.
+func RoleDefaults(role common.AssumeRole) common.AssumeRole {
+	if role.SessionName == "" {
+		role.SessionName = defaultRoleSessionName
+	}
+	if role.Duration <= 0 {
+		role.Duration = defaultRoleDuration
+	}
+	if role.RefreshBefore <= 0 {
+		role.RefreshBefore = defaultRoleRefreshBefore
+	}
+	return role
+}
+
+// CallSTS sends the signed request to the STS service and returns the response body if it succeeded.
+func CallSTS(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSTSResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sts responded %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
+
+// assumeRole gets the temporary credential of the role of the endpoint, nil is returned if no role is configured.
+func (s *ImplProviderService) assumeRole(ctx context.Context, endpoint common.Endpoint, credentials common.Credentials) (*RoleSession, error) {
+	role := credentials.AssumeRole
+	if role.RoleArn == "" {
+		return nil, nil
+	}
+	assumer, found := roleAssumers[endpoint.Vendor]
+	if !found {
+		return nil, fmt.Errorf("AssumeRole is not supported by vendor %s", endpoint.Vendor)
+	}
+	role = RoleDefaults(role)
+	if role.RefreshBefore >= role.Duration {
+		return nil, fmt.Errorf("AssumeRole.RefreshBefore (%ds) must be less than AssumeRole.Duration (%ds)", role.RefreshBefore, role.Duration)
+	}
+	ctx, cancel := context.WithTimeout(ctx, stsTimeout)
+	defer cancel()
+	session, err := assumer(ctx, s.stsClient, credentials.Real, role)
+	if err != nil {
+		return nil, fmt.Errorf("assume role %s failed: %v", role.RoleArn, err)
+	}
+	if session.Credential.AccessKey == "" || session.Credential.SecretKey == "" {
+		return nil, fmt.Errorf("assume role %s failed: empty credential returned", role.RoleArn)
+	}
+	return &session, nil
+}
+
+// RefreshRoleSessions assumes the roles again before their temporary credentials expire. Providers keep their
+// current credentials if the STS service is unavailable, and the refresh is retried on the next call.
+func (s *ImplProviderService) RefreshRoleSessions(ctx context.Context) error {
+	s.mu.RLock()
+	current := make([]*endpointProvider, 0, len(s.endpointProviders))
+	for _, provider := range s.endpointProviders {
+		if provider.session != nil {
+			current = append(current, provider)
+		}
+	}
+	s.mu.RUnlock()
+
+	var errs []string
+	for _, provider := range current {
+		endpoint := provider.endpoint
+		role := RoleDefaults(provider.credentials.AssumeRole)
+		if time.Until(provider.session.Expiration) > time.Duration(role.RefreshBefore)*time.Second {
+			continue
+		}
+		session, err := s.assumeRole(ctx, endpoint, provider.credentials)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("cloud account %s: %v", endpoint.CloudAccountName, err))
+			continue
+		}
+		s.replaceEndpointProvider(provider, newEndpointProvider(providers[endpoint.Vendor], endpoint, provider.credentials, provider.allowedHosts, s.maxAge, session))
+		logs.CtxInfo(ctx, "temporary credential of cloud account (name: %v) has been refreshed, expires at %s",
+			endpoint.CloudAccountName, session.Expiration.Format(time.RFC3339))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
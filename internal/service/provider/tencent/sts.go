@@ -0,0 +1,113 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package tencent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/service/provider"
+)
+
+const (
+	stsDefaultRegion   = "ap-guangzhou"
+	stsDefaultEndpoint = "https://sts.tencentcloudapi.com"
+	stsVersion         = "2018-08-13"
+)
+
+type assumeRoleRequest struct {
+	RoleArn         string
+	RoleSessionName string
+	DurationSeconds int
+	ExternalId      string `json:",omitempty"`
+}
+
+type assumeRoleResponse struct {
+	Response struct {
+		Error *struct {
+			Code    string
+			Message string
+		}
+		Credentials struct {
+			Token        string
+			TmpSecretId  string
+			TmpSecretKey string
+		}
+		ExpiredTime int64
+	}
+}
+
+// assumeRole calls AssumeRole of Tencent Cloud STS.
+func assumeRole(ctx context.Context, client *http.Client, cre common.Credential, role common.AssumeRole) (provider.RoleSession, error) {
+	region := role.Region
+	if region == "" {
+		region = stsDefaultRegion
+	}
+	endpoint := role.Endpoint
+	if endpoint == "" {
+		endpoint = stsDefaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	u.Path = "/"
+	payload, err := json.Marshal(assumeRoleRequest{
+		RoleArn:         role.RoleArn,
+		RoleSessionName: role.SessionName,
+		DurationSeconds: role.Duration,
+		ExternalId:      role.ExternalId,
+	})
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(actionHeaderKey, "AssumeRole")
+	req.Header.Set(versionHeaderKey, stsVersion)
+	req.Header.Set(regionHeaderKey, region)
+	req.Header.Set(timestampHeaderKey, strconv.FormatInt(now.Unix(), 10))
+	if cre.AccessToken != "" {
+		req.Header.Set(tokenHeaderKey, cre.AccessToken)
+	}
+	authorization, err := Sign(req, now.UTC(), cre.AccessKey, cre.SecretKey, u.Host, "sts")
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	req.Header.Set(signatureHeaderKey, authorization)
+	body, err := provider.CallSTS(client, req)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	var resp assumeRoleResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return provider.RoleSession{}, fmt.Errorf("decode response failed: %v", err)
+	}
+	if resp.Response.Error != nil {
+		return provider.RoleSession{}, fmt.Errorf("%s: %s", resp.Response.Error.Code, resp.Response.Error.Message)
+	}
+	credentials := resp.Response.Credentials
+	return provider.RoleSession{
+		Credential: common.Credential{
+			AccessKey:   credentials.TmpSecretId,
+			SecretKey:   credentials.TmpSecretKey,
+			AccessToken: credentials.Token,
+		},
+		Expiration: time.Unix(resp.Response.ExpiredTime, 0),
+	}, nil
+}
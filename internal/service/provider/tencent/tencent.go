@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
 	"strconv"
@@ -21,6 +22,10 @@ import (
 const (
 	signatureHeaderKey = "Authorization"
 	timestampHeaderKey = "X-TC-Timestamp"
+	actionHeaderKey    = "X-TC-Action"
+	regionHeaderKey    = "X-TC-Region"
+	versionHeaderKey   = "X-TC-Version"
+	tokenHeaderKey     = "X-TC-Token"
 	hostHeaderKey      = "Host"
 	signTimeKey        = "VolcTime"
 	serviceKey         = "VolcService"
@@ -32,6 +37,15 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &tencentProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.tencentcloudapi.com", "cdn.api.qcloud.com")
+	provider.RegisterProbeHosts(vendorName, "cdn.tencentcloudapi.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{
+		Headers: []string{signatureHeaderKey, tokenHeaderKey},
+		Query:   []string{"Signature", "Token"},
+	})
+	provider.RegisterRoleAssumer(vendorName, assumeRole)
 }
 
 type tencentProvider struct {
@@ -58,6 +72,7 @@ func (s *tencentProvider) ValidateRequest(ctx context.Context, req *http.Request
 	service := items[2]
 	ctx = context.WithValue(ctx, signTimeKey, signTime)
 	ctx = context.WithValue(ctx, serviceKey, service)
+	ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Signature: requestSign})
 	cre := s.Credentials.Proxy
 	computedSign, err := Sign(req, signTime, cre.AccessKey, cre.SecretKey, req.URL.Host, service)
 	if err != nil {
@@ -75,5 +90,46 @@ func (s *tencentProvider) ResignRequest(ctx context.Context, req *http.Request)
 		return fmt.Errorf("compute signature failed: %v", err)
 	}
 	req.Header.Set(signatureHeaderKey, computedSign)
+	if cre.AccessToken != "" {
+		req.Header.Set(tokenHeaderKey, cre.AccessToken)
+	}
 	return nil
 }
+
+func (s *tencentProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	service, _ := ctx.Value(serviceKey).(string)
+	return provider.Operation{Service: service, Action: req.Header.Get(actionHeaderKey), Region: req.Header.Get(regionHeaderKey)}
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *tencentProvider) ProxyAccessKey(req *http.Request) string {
+	return provider.CredentialScopeAccessKey(req.Header.Get(signatureHeaderKey))
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, "https://cdn.tencentcloudapi.com/", strings.NewReader("{}"))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(actionHeaderKey, "DescribeDomains")
+	req.Header.Set(versionHeaderKey, "2018-06-06")
+	req.Header.Set(timestampHeaderKey, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(signatureHeaderKey, fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s/cdn/tc3_request, SignedHeaders=content-type;host, Signature=selftest",
+		credential.AccessKey, now.UTC().Format("2006-01-02")))
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the API 3.0 of Tencent Cloud, which are responded with status 200.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	code, message := "AuthFailure.SignatureFailure", "The provided credentials could not be validated. Please check your signature is correct."
+	if reason == provider.QuarantineInvalidAccessKey {
+		code, message = "AuthFailure.SecretIdNotFound", "The SecretId is not found, please ensure that your SecretId is correct."
+	}
+	return provider.JSONResponse(http.StatusOK, map[string]interface{}{
+		"Response": map[string]interface{}{
+			"Error":     map[string]string{"Code": code, "Message": message},
+			"RequestId": requestId,
+		},
+	})
+}
@@ -11,9 +11,13 @@ import (
 	"context"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/volcengine/key-proxy/internal/utils"
 )
@@ -28,6 +32,16 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &ucloudProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.ucloud.cn")
+	provider.RegisterProbeHosts(vendorName, "api.ucloud.cn")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	// the signatures of the parameters carry no signing time, so the requests cannot be checked for replays
+	provider.RegisterReplayExempt(vendorName)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{
+		Query:      []string{ucloudSignatureKey},
+		BodyFields: []string{ucloudSignatureKey},
+	})
 }
 
 type ucloudProvider struct {
@@ -84,3 +98,30 @@ func setBody(req *http.Request, body string) {
 	req.ContentLength = int64(length)
 	req.Body = ioutil.NopCloser(bytes.NewReader([]byte(body)))
 }
+
+func (s *ucloudProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	payload, err := getBody(req)
+	if err != nil {
+		return provider.Operation{Service: "ucdn"}
+	}
+	return provider.Operation{Service: "ucdn", Action: payload["Action"], Region: payload["Region"]}
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	body := url.Values{"Action": {"GetUcdnDomainInfoList"}, ucloudPublicKey: {credential.AccessKey}, ucloudSignatureKey: {"selftest"}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, "https://api.ucloud.cn/", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the APIs of UCloud, which are responded with status 200.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	retCode, message := 171, "Signature VerifyAC Error"
+	if reason == provider.QuarantineInvalidAccessKey {
+		retCode, message = 172, "Access denied, invalid public key"
+	}
+	return provider.JSONResponse(http.StatusOK, map[string]interface{}{"RetCode": retCode, "Message": message, "RequestUUID": requestId})
+}
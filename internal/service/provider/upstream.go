@@ -0,0 +1,129 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/volcengine/key-proxy/internal/base"
+)
+
+var (
+	defaultHosts = make(map[string][]string, 12)
+
+	forbiddenNetworks = mustParseCIDRs(
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	)
+)
+
+// RegisterDefaultHosts registers the host patterns that requests of the vendor are allowed to be sent to,
+// if the endpoint does not configure AllowedHosts.
+func RegisterDefaultHosts(vendor string, hosts ...string) {
+	defaultHosts[vendor] = append(defaultHosts[vendor], hosts...)
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsForbiddenIP reports whether the ip is a loopback, private, link-local or unspecified address.
+func IsForbiddenIP(ip net.IP) bool {
+	for _, network := range forbiddenNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost matches the host with patterns like "*.volcengineapi.com", "cdn.api.qcloud.com" or "*".
+func matchHost(host string, patterns []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		switch {
+		case pattern == "*":
+			return true
+		case strings.HasPrefix(pattern, "*."):
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		case pattern == host:
+			return true
+		}
+	}
+	return false
+}
+
+// checkUpstream checks the target url against the allowed host patterns, and makes sure the host
+// does not resolve to an internal address unless private network is allowed.
+// A non-nil error with forbidden being false means the host could not be resolved.
+func checkUpstream(ctx context.Context, u *url.URL, allowedHosts []string, allowPrivateNetwork bool) (forbidden bool, err error) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return true, fmt.Errorf("unsupported scheme: %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return true, fmt.Errorf("the host of the target url is empty")
+	}
+	if !matchHost(host, allowedHosts) {
+		return true, fmt.Errorf("host %s is not in the allowed hosts: [%s]", host, strings.Join(allowedHosts, ", "))
+	}
+	if allowPrivateNetwork {
+		return false, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if IsForbiddenIP(ip) {
+			return true, fmt.Errorf("host %s is an internal address", host)
+		}
+		return false, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return false, fmt.Errorf("resolve host %s failed: %v", host, err)
+	}
+	for _, addr := range addrs {
+		if IsForbiddenIP(addr.IP) {
+			return true, fmt.Errorf("host %s resolves to an internal address %s", host, addr.IP)
+		}
+	}
+	return false, nil
+}
+
+// enforceUpstream panics with UpstreamHostForbidden if the target url is not allowed, or with NetworkErr
+// if its host could not be resolved. The prefix tells which provider the request belongs to.
+func enforceUpstream(ctx context.Context, u *url.URL, allowedHosts []string, allowPrivateNetwork bool, prefix string) {
+	forbidden, err := checkUpstream(ctx, u, allowedHosts, allowPrivateNetwork)
+	if err != nil && forbidden {
+		panic(base.UpstreamHostForbidden.WithRawError(fmt.Errorf("%s %v", prefix, err)))
+	}
+	if err != nil {
+		panic(base.NetworkErr.WithRawError(err))
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package provider
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/volcengine/key-proxy/internal/base"
+)
+
+func TestIsForbiddenIP(t *testing.T) {
+	cases := map[string]bool{
+		"0.0.0.0":         true,
+		"10.1.2.3":        true,
+		"100.64.0.1":      true,
+		"127.0.0.1":       true,
+		"169.254.169.254": true,
+		"172.16.0.1":      true,
+		"172.31.255.255":  true,
+		"192.168.1.1":     true,
+		"::":              true,
+		"::1":             true,
+		"fd00::1":         true,
+		"fe80::1":         true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+		"172.32.0.1":      false,
+		"100.128.0.1":     false,
+		"2001:4860::8888": false,
+	}
+	for ip, forbidden := range cases {
+		if IsForbiddenIP(net.ParseIP(ip)) != forbidden {
+			t.Errorf("%s: forbidden is %v, want %v", ip, !forbidden, forbidden)
+		}
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	patterns := []string{"*.volcengineapi.com", "cdn.api.qcloud.com"}
+	cases := map[string]bool{
+		"open.volcengineapi.com":  true,
+		"OPEN.VolcengineAPI.com.": true,
+		"a.b.volcengineapi.com":   true,
+		"cdn.api.qcloud.com":      true,
+		"volcengineapi.com":       false,
+		"evilvolcengineapi.com":   false,
+		"volcengineapi.com.evil":  false,
+		"api.qcloud.com":          false,
+		"x.cdn.api.qcloud.com":    false,
+	}
+	for host, matched := range cases {
+		if matchHost(host, patterns) != matched {
+			t.Errorf("%s: matched is %v, want %v", host, !matched, matched)
+		}
+	}
+	if !matchHost("anything.example.com", []string{"*"}) {
+		t.Errorf("* does not match any host")
+	}
+	if matchHost("open.volcengineapi.com", nil) {
+		t.Errorf("empty patterns match a host")
+	}
+}
+
+func TestCheckUpstream(t *testing.T) {
+	allowed := []string{"*.volcengineapi.com", "127.0.0.1", "10.0.0.1"}
+	cases := []struct {
+		url                 string
+		allowPrivateNetwork bool
+		forbidden           bool
+		failed              bool
+	}{
+		{"https://open.volcengineapi.com/?Action=ListCdnDomains", true, false, false},
+		{"http://open.volcengineapi.com/", true, false, false},
+		{"ftp://open.volcengineapi.com/", true, true, true},
+		{"https:///path", true, true, true},
+		{"https://evil.com/", true, true, true},
+		{"https://evil.com/?x=open.volcengineapi.com", true, true, true},
+		{"https://open.volcengineapi.com@evil.com/", true, true, true},
+		{"https://127.0.0.1/", true, false, false},
+		{"https://127.0.0.1/", false, true, true},
+		{"https://10.0.0.1:8443/", false, true, true},
+		{"https://8.8.8.8/", false, true, true},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forbidden, err := checkUpstream(context.Background(), u, allowed, c.allowPrivateNetwork)
+		if forbidden != c.forbidden || (err != nil) != c.failed {
+			t.Errorf("%s (private network allowed: %v): forbidden is %v, error is %v", c.url, c.allowPrivateNetwork, forbidden, err)
+		}
+	}
+}
+
+func TestEnforceUpstream(t *testing.T) {
+	u, _ := url.Parse("https://evil.com/")
+	defer func() {
+		exception, ok := recover().(base.Exception)
+		if !ok || exception.Code != base.UpstreamHostForbidden.Code {
+			t.Errorf("recovered %v, want %s", exception, base.UpstreamHostForbidden.Code)
+		}
+	}()
+	enforceUpstream(context.Background(), u, defaultHosts["test"], false, "[test]")
+}
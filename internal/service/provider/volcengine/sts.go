@@ -0,0 +1,104 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package volcengine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/service/provider"
+)
+
+const (
+	stsDefaultRegion   = "cn-north-1"
+	stsDefaultEndpoint = "https://sts.volcengineapi.com"
+	stsVersion         = "2018-01-01"
+)
+
+type assumeRoleResponse struct {
+	ResponseMetadata struct {
+		Error *struct {
+			Code    string
+			Message string
+		}
+	}
+	Result struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			ExpiredTime     time.Time
+		}
+	}
+}
+
+// assumeRole calls AssumeRole of Volcengine STS, the role is identified by its trn.
+func assumeRole(ctx context.Context, client *http.Client, cre common.Credential, role common.AssumeRole) (provider.RoleSession, error) {
+	region := role.Region
+	if region == "" {
+		region = stsDefaultRegion
+	}
+	endpoint := role.Endpoint
+	if endpoint == "" {
+		endpoint = stsDefaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {stsVersion},
+		"RoleTrn":         {role.RoleArn},
+		"RoleSessionName": {role.SessionName},
+		"DurationSeconds": {strconv.Itoa(role.Duration)},
+	}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	signResult, err := sign(req, Credentials{AccessKeyID: cre.AccessKey, SecretAccessKey: cre.SecretKey, Service: "sts", Region: region}, time.Now().UTC())
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	req.Header.Set("Content-Type", signResult.ContentType)
+	req.Header.Set(signTimeHeaderKey, signResult.XDate)
+	req.Header.Set("X-Content-Sha256", signResult.XContentSha256)
+	req.Header.Set(signatureHeaderKey, signResult.Authorization)
+	if cre.AccessToken != "" {
+		req.Header.Set(securityTokenHeaderKey, cre.AccessToken)
+	}
+	body, err := provider.CallSTS(client, req)
+	if err != nil {
+		return provider.RoleSession{}, err
+	}
+	var resp assumeRoleResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return provider.RoleSession{}, fmt.Errorf("decode response failed: %v", err)
+	}
+	if resp.ResponseMetadata.Error != nil {
+		return provider.RoleSession{}, fmt.Errorf("%s: %s", resp.ResponseMetadata.Error.Code, resp.ResponseMetadata.Error.Message)
+	}
+	credentials := resp.Result.Credentials
+	return provider.RoleSession{
+		Credential: common.Credential{
+			AccessKey:   credentials.AccessKeyId,
+			SecretKey:   credentials.SecretAccessKey,
+			AccessToken: credentials.SessionToken,
+		},
+		Expiration: credentials.ExpiredTime,
+	}, nil
+}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
 	"strings"
@@ -18,18 +19,28 @@ import (
 )
 
 const (
-	signatureHeaderKey = "Authorization"
-	signTimeHeaderKey  = "X-Date"
-	signTimeKey        = "VolcTime"
-	serviceKey         = "VolcService"
-	regionKey          = "VolcRegion"
-	vendorName         = "volcengine"
+	signatureHeaderKey     = "Authorization"
+	signTimeHeaderKey      = "X-Date"
+	securityTokenHeaderKey = "X-Security-Token"
+	signTimeKey            = "VolcTime"
+	serviceKey             = "VolcService"
+	regionKey              = "VolcRegion"
+	vendorName             = "volcengine"
 )
 
 func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &volcengineProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.volcengineapi.com")
+	provider.RegisterProbeHosts(vendorName, "open.volcengineapi.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{
+		Headers: []string{signatureHeaderKey, securityTokenHeaderKey},
+		Query:   []string{"X-Signature", securityTokenHeaderKey},
+	})
+	provider.RegisterRoleAssumer(vendorName, assumeRole)
 }
 
 type volcengineProvider struct {
@@ -57,6 +68,7 @@ func (s *volcengineProvider) ValidateRequest(ctx context.Context, req *http.Requ
 	ctx = context.WithValue(ctx, signTimeKey, signTime)
 	ctx = context.WithValue(ctx, serviceKey, service)
 	ctx = context.WithValue(ctx, regionKey, region)
+	ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Signature: requestSign})
 	cre := s.Credentials.Proxy
 	signResult, err := sign(req, Credentials{AccessKeyID: cre.AccessKey, SecretAccessKey: cre.SecretKey, Service: service, Region: region}, signTime)
 	if err != nil {
@@ -76,5 +88,44 @@ func (s *volcengineProvider) ResignRequest(ctx context.Context, req *http.Reques
 		return fmt.Errorf("compute signature failed: %v", err)
 	}
 	req.Header.Set(signatureHeaderKey, signResult.Authorization)
+	if cre.AccessToken != "" {
+		req.Header.Set(securityTokenHeaderKey, cre.AccessToken)
+	}
 	return nil
 }
+
+func (s *volcengineProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	service, _ := ctx.Value(serviceKey).(string)
+	region, _ := ctx.Value(regionKey).(string)
+	return provider.Operation{Service: service, Action: req.URL.Query().Get("Action"), Region: region}
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *volcengineProvider) ProxyAccessKey(req *http.Request) string {
+	return provider.CredentialScopeAccessKey(req.Header.Get(signatureHeaderKey))
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://open.volcengineapi.com/?Action=ListCdnDomains&Version=2021-03-01", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(signTimeHeaderKey, now.UTC().Format("20060102T150405Z"))
+	req.Header.Set(signatureHeaderKey, fmt.Sprintf("HMAC-SHA256 Credential=%s/%s/cn-north-1/cdn/request, SignedHeaders=host;x-date, Signature=selftest",
+		credential.AccessKey, now.UTC().Format("20060102")))
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the OpenAPI of Volcengine.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	status, codeN, code, message := http.StatusForbidden, 100010, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	if reason == provider.QuarantineInvalidAccessKey {
+		status, codeN, code, message = http.StatusUnauthorized, 100009, "InvalidAccessKey", "The request has an invalid access key."
+	}
+	return provider.JSONResponse(status, map[string]interface{}{
+		"ResponseMetadata": map[string]interface{}{
+			"RequestId": requestId,
+			"Error":     map[string]interface{}{"CodeN": codeN, "Code": code, "Message": message},
+		},
+	})
+}
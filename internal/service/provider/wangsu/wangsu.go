@@ -8,10 +8,14 @@ package wangsu
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const (
@@ -25,6 +29,11 @@ func init() {
 	provider.RegisterProvider(vendorName, func(credential common.Credentials) provider.IProvider {
 		return &wangsuProvider{Credentials: credential}
 	})
+	provider.RegisterDefaultHosts(vendorName, "*.chinanetcenter.com", "*.wangsu.com", "*.cdnetworks.com")
+	provider.RegisterProbeHosts(vendorName, "open.chinanetcenter.com")
+	provider.RegisterSampleRequest(vendorName, sampleRequest)
+	provider.RegisterQuarantineResponse(vendorName, quarantineResponse)
+	base.RegisterRedactionRules(vendorName, base.RedactionRules{Headers: []string{"Authorization"}})
 }
 
 type wangsuProvider struct {
@@ -41,6 +50,9 @@ func (s *wangsuProvider) ValidateRequest(ctx context.Context, req *http.Request)
 		return ctx, false, fmt.Errorf("invalid parameters: miss Date in the query parameters")
 	}
 	ctx = context.WithValue(ctx, "Date", date)
+	if signTime, err := http.ParseTime(date); err == nil {
+		ctx = provider.WithRequestSignature(ctx, provider.RequestSignature{SignTime: signTime, Signature: req.Header.Get(authorizationKey)})
+	}
 	fakeSignature := req.Header.Get(authorizationKey)
 	computeSignature := authorizationPrefix + authorize(s.Credentials.Proxy.AccessKey, hmac64(date, s.Credentials.Proxy.SecretKey))
 	return ctx, fakeSignature == computeSignature, nil
@@ -53,3 +65,39 @@ func (s *wangsuProvider) ResignRequest(ctx context.Context, req *http.Request) e
 	req.Header.Set(authorizationKey, realSignature)
 	return nil
 }
+
+func (s *wangsuProvider) Operation(ctx context.Context, req *http.Request) provider.Operation {
+	return provider.RestOperation("cdn", req)
+}
+
+// ProxyAccessKey implements provider.AccessKeyParser.
+func (s *wangsuProvider) ProxyAccessKey(req *http.Request) string {
+	// Basic base64({accessKey}:{signature})
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.Header.Get(authorizationKey), authorizationPrefix))
+	if err != nil {
+		return ""
+	}
+	if index := strings.Index(string(decoded), ":"); index >= 0 {
+		return string(decoded[:index])
+	}
+	return ""
+}
+
+func sampleRequest(credential common.Credential, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://open.chinanetcenter.com/api/domain", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(dateHeaderKey, now.UTC().Format(http.TimeFormat))
+	req.Header.Set(authorizationKey, authorizationPrefix+"selftest")
+	return req, nil
+}
+
+// quarantineResponse renders the errors of the OpenAPI of Wangsu.
+func quarantineResponse(reason provider.QuarantineReason, requestId string) base.VendorResponse {
+	code, message := "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	if reason == provider.QuarantineInvalidAccessKey {
+		code, message = "InvalidAccessKeyId", "The access key id you provided does not exist."
+	}
+	return provider.JSONResponse(http.StatusUnauthorized, map[string]string{"code": code, "message": message, "requestId": requestId})
+}
@@ -7,7 +7,10 @@ Use of this source code is governed by the license that can be found in the LICE
 package service
 
 import (
+	"context"
+
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/config"
 	"github.com/volcengine/key-proxy/internal/service/provider"
 
 	_ "github.com/volcengine/key-proxy/internal/service/provider/akamai"
@@ -25,19 +28,30 @@ import (
 	_ "github.com/volcengine/key-proxy/internal/service/provider/wangsu"
 )
 
-var (
-	providerService provider.IProviderService
-)
-
+// GetProviderService returns the providers of the current snapshot, it is nil until Init succeeds.
 func GetProviderService() provider.IProviderService {
-	return providerService
+	service, _ := config.Current().Providers.(provider.IProviderService)
+	return service
+}
+
+// ProviderServiceFromContext returns the providers of the snapshot bound to the request.
+func ProviderServiceFromContext(ctx context.Context) provider.IProviderService {
+	service, _ := config.FromContext(ctx).Providers.(provider.IProviderService)
+	return service
 }
 
-func Init(config *common.Config) error {
-	var err error
-	providerService, err = provider.New(config.Endpoints)
+// Init builds the providers with the config, then publishes both of them as a snapshot. The current snapshot is only
+// replaced if all the providers are built successfully, so the requests in flight keep using the old one.
+func Init(conf *common.Config) error {
+	snapshot, err := config.NewSnapshot(conf)
+	if err != nil {
+		return err
+	}
+	service, err := provider.New(conf)
 	if err != nil {
 		return err
 	}
+	snapshot.Providers = provider.IProviderService(service)
+	config.Publish(snapshot)
 	return nil
 }
@@ -0,0 +1,166 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultEndpoint    = "http://127.0.0.1:4318/v1/traces"
+	defaultServiceName = "key-proxy"
+	scopeName          = "github.com/volcengine/key-proxy"
+)
+
+// SpanKind follows the span kinds of OpenTelemetry.
+type SpanKind = trace.SpanKind
+
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+)
+
+var (
+	propagator = propagation.TraceContext{}
+
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider
+)
+
+// Extract returns a context carrying the span context of the traceparent header, the spans started with it
+// become the children of the remote span.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Span records an operation of a request. The spans which are not sampled, or started while tracing is disabled,
+// are not recorded, and all the methods of them do nothing.
+type Span struct {
+	span trace.Span
+}
+
+// Start starts a span as the child of the current span in the context, and returns the context carrying the new span.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	ctx, span := otel.Tracer(scopeName).Start(ctx, name, trace.WithSpanKind(kind))
+	return ctx, &Span{span: span}
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+func (s *Span) SetIntAttribute(key string, value int) {
+	s.span.SetAttributes(attribute.Int(key, value))
+}
+
+// SetError marks the span as failed with the redacted error, nil errors are ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.SetStatus(codes.Error, base.RedactText(err.Error()))
+}
+
+// End ends the span. When deferred, it also marks the span as failed if the function panicked, and panics again
+// with the same value.
+func (s *Span) End() {
+	if r := recover(); r != nil {
+		if err, ok := r.(error); ok {
+			s.SetError(err)
+		} else {
+			s.SetError(fmt.Errorf("%v", r))
+		}
+		s.span.End()
+		panic(r)
+	}
+	s.span.End()
+}
+
+// Init starts exporting the spans with OTLP/HTTP if tracing is enabled. It should be called once before serving.
+func Init(conf common.Tracing) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !conf.Enabled || provider != nil {
+		return
+	}
+	options, err := exporterOptions(conf)
+	if err != nil {
+		logs.CtxError(context.Background(), "[Tracing] tracing is disabled: %v", err)
+		return
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		logs.CtxError(context.Background(), "[Tracing] tracing is disabled, create exporter failed: %v", err)
+		return
+	}
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	sampleRatio := 1.0
+	if conf.SampleRatio != nil {
+		sampleRatio = *conf.SampleRatio
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		// the traces continued from the platform follow its sampling decision
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logs.CtxWarn(context.Background(), "[Tracing] %v", base.RedactText(err.Error()))
+	}))
+}
+
+// exporterOptions converts the url of the collector into the options of the exporter.
+func exporterOptions(conf common.Tracing) ([]otlptracehttp.Option, error) {
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid Tracing.Endpoint: %q", endpoint)
+	}
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(u.Path),
+		otlptracehttp.WithHeaders(conf.Headers),
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return options, nil
+}
+
+// Shutdown exports the ended spans and stops exporting, the spans ended afterwards are dropped.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
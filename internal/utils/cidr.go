@@ -0,0 +1,92 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseCIDRs parses CIDRs like "10.0.0.0/8", single addresses are treated as /32 or /128.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address: %q", cidr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr: %q", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ContainsIP reports whether any of the networks contains the ip.
+func ContainsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnixSocketClient identifies the clients of the unix socket listener, which have no ip. It can be listed in the
+// AllowedCIDRs and the TrustedProxies like an address.
+const UnixSocketClient = "unix"
+
+// IPList is a parsed list of CIDRs, which may include UnixSocketClient.
+type IPList struct {
+	Networks []*net.IPNet
+	Unix     bool
+}
+
+// ParseIPList parses the CIDRs and UnixSocketClient.
+func ParseIPList(entries []string) (IPList, error) {
+	var list IPList
+	cidrs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == UnixSocketClient {
+			list.Unix = true
+			continue
+		}
+		cidrs = append(cidrs, entry)
+	}
+	networks, err := ParseCIDRs(cidrs)
+	if err != nil {
+		return IPList{}, err
+	}
+	list.Networks = networks
+	return list, nil
+}
+
+// Empty reports whether the list has no entry.
+func (l IPList) Empty() bool {
+	return len(l.Networks) == 0 && !l.Unix
+}
+
+// Contains reports whether the client, which is an ip or UnixSocketClient, is in the list.
+func (l IPList) Contains(client string) bool {
+	if client == UnixSocketClient {
+		return l.Unix
+	}
+	ip := net.ParseIP(client)
+	return ip != nil && ContainsIP(l.Networks, ip)
+}
@@ -8,7 +8,6 @@ package utils
 
 import (
 	"bytes"
-	"encoding/base64"
 	"io/ioutil"
 	"net/http"
 	"sort"
@@ -58,10 +57,6 @@ func GetCurlCommand(req *http.Request) (*CurlCommand, error) {
 
 	for _, k := range keys {
 		v := strings.Join(req.Header[k], " ")
-		if strings.ToLower(k) == "authorization" {
-			tmp, _ := base64.StdEncoding.DecodeString(v)
-			v = strings.Split(string(tmp), ":")[0]
-		}
 		command.append("-H", bashEscape(k+": "+v))
 	}
 
@@ -10,7 +10,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
-	"github.com/volcengine/key-proxy/internal/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -18,6 +17,11 @@ import (
 	"path/filepath"
 )
 
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
 var _logger common.Logger
 
 var logLevels = map[string]zapcore.Level{
@@ -34,8 +38,9 @@ func MustInit(customLogger common.Logger) {
 	_logger = customLogger
 }
 
-func NewStandardLogger() (common.Logger, error) {
-	logConf := config.Conf.Log
+// NewStandardLogger builds the default logger with the Log config. The logs are written to the stdout and to the
+// rotated file, in which they are never colored.
+func NewStandardLogger(logConf common.Log) (common.Logger, error) {
 	filename, err := filepath.Abs(filepath.Join(logConf.Output, "./key_proxy.log"))
 	if err != nil {
 		return nil, err
@@ -56,21 +61,67 @@ func NewStandardLogger() (common.Logger, error) {
 	}
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-	encoder := zapcore.NewConsoleEncoder(encoderConfig)
+	var stdoutEncoder, fileEncoder zapcore.Encoder
+	switch logConf.Format {
+	case "", FormatConsole:
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		fileEncoder = zapcore.NewConsoleEncoder(encoderConfig)
+		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		stdoutEncoder = zapcore.NewConsoleEncoder(encoderConfig)
+	case FormatJSON:
+		fileEncoder = zapcore.NewJSONEncoder(encoderConfig)
+		stdoutEncoder = fileEncoder
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected %s or %s", logConf.Format, FormatConsole, FormatJSON)
+	}
 	actualLevel, found := logLevels[logConf.Level]
 	if !found {
 		actualLevel = logLevels["info"]
 	}
+	// the level can be changed at runtime by SetLevel
+	level := zap.NewAtomicLevelAt(actualLevel)
 	core := zapcore.NewTee(
-		zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), actualLevel),
-		zapcore.NewCore(encoder, zapcore.AddSync(writer), actualLevel),
+		zapcore.NewCore(stdoutEncoder, zapcore.AddSync(os.Stdout), level),
+		zapcore.NewCore(fileEncoder, zapcore.AddSync(writer), level),
 	)
+	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1))
 	return &StandardLogger{
-		sugarLogger: zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar(),
+		sugarLogger: logger.Sugar(),
+		// the Ctx methods are called through the functions of this package
+		ctxLogger: logger.WithOptions(zap.AddCallerSkip(1)).Sugar(),
+		level:     level,
 	}, nil
 }
 
+// SetLevel changes the level of the logger at runtime, if the logger supports it.
+func SetLevel(level string) error {
+	if _, found := logLevels[level]; !found {
+		return fmt.Errorf("unknown log level %q, expected debug, info, warn or error", level)
+	}
+	leveler, ok := _logger.(interface{ SetLevel(level string) })
+	if !ok {
+		return fmt.Errorf("the level of the custom logger cannot be changed")
+	}
+	leveler.SetLevel(level)
+	return nil
+}
+
+// Level returns the current level of the logger, it is empty if the logger does not support it.
+func Level() string {
+	if leveler, ok := _logger.(interface{ Level() string }); ok {
+		return leveler.Level()
+	}
+	return ""
+}
+
+// Sync flushes the buffered logs if the logger supports it.
+func Sync() error {
+	if syncer, ok := _logger.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
 func CtxDebug(ctx context.Context, template string, args ...interface{}) {
 	_logger.CtxDebug(ctx, template, args...)
 }
@@ -8,12 +8,24 @@ package logs
 
 import (
 	"context"
+	"github.com/volcengine/key-proxy/common"
 	"go.uber.org/zap"
 )
 
 // StandardLogger uses zap as the logger, implements the logger interface.
 type StandardLogger struct {
 	sugarLogger *zap.SugaredLogger
+	ctxLogger   *zap.SugaredLogger
+	level       zap.AtomicLevel
+}
+
+// SetLevel changes the level, which must be one of debug, info, warn and error.
+func (s *StandardLogger) SetLevel(level string) {
+	s.level.SetLevel(logLevels[level])
+}
+
+func (s *StandardLogger) Level() string {
+	return s.level.String()
 }
 
 func (s *StandardLogger) Debug(template string, args ...interface{}) {
@@ -36,21 +48,39 @@ func (s *StandardLogger) Fatal(template string, args ...interface{}) {
 	s.sugarLogger.Fatalf(template, args...)
 }
 
+func (s *StandardLogger) Sync() error {
+	return s.sugarLogger.Sync()
+}
+
+// withFields attaches the request-scoped fields of the context to the logs.
+func (s *StandardLogger) withFields(ctx context.Context) *zap.SugaredLogger {
+	fields := common.LogFields(ctx)
+	if len(fields) == 0 {
+		return s.ctxLogger
+	}
+	args := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		args = append(args, zap.String(field.Key, field.Value))
+	}
+	return s.ctxLogger.With(args...)
+}
+
 func (s *StandardLogger) CtxDebug(ctx context.Context, template string, args ...interface{}) {
-	s.Debug(template, args...)
+	s.withFields(ctx).Debugf(template, args...)
 }
+
 func (s *StandardLogger) CtxInfo(ctx context.Context, template string, args ...interface{}) {
-	s.Info(template, args...)
+	s.withFields(ctx).Infof(template, args...)
 }
 
 func (s *StandardLogger) CtxWarn(ctx context.Context, template string, args ...interface{}) {
-	s.Warn(template, args...)
+	s.withFields(ctx).Warnf(template, args...)
 }
 
 func (s *StandardLogger) CtxError(ctx context.Context, template string, args ...interface{}) {
-	s.Error(template, args...)
+	s.withFields(ctx).Errorf(template, args...)
 }
 
 func (s *StandardLogger) CtxFatal(ctx context.Context, template string, args ...interface{}) {
-	s.Fatal(template, args...)
+	s.withFields(ctx).Fatalf(template, args...)
 }
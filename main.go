@@ -7,25 +7,208 @@ Use of this source code is governed by the license that can be found in the LICE
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/volcengine/key-proxy/internal/audit"
+	"github.com/volcengine/key-proxy/internal/secret"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
 	"github.com/volcengine/key-proxy/pkg/proxy"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "encrypt":
+			err = encrypt(os.Args[2:], false)
+		case "rotate":
+			err = encrypt(os.Args[2:], true)
+		case "gen-master-key":
+			err = genMasterKey()
+		case "verify-audit":
+			err = verifyAudit(os.Args[2:])
+		default:
+			run()
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	run()
+}
+
+func run() {
 	var configFile string
+	var watchInterval int
 	flag.StringVar(&configFile, "conf-file", "./config.yml", "config file path")
+	flag.IntVar(&watchInterval, "watch-interval", 5, "interval in seconds to check the config file for changes, 0 disables watching")
 	flag.Parse()
 
 	config, err := proxy.LoadYamlConfig(configFile)
 	if err != nil {
 		panic(err)
 	}
-	keyProxy, err := proxy.New(config)
+	keyProxy, err := proxy.New(config, proxy.WithConfigFile(configFile))
 	if err != nil {
 		panic(err)
 	}
-	err = keyProxy.Run()
+	go reloadOnSignal(keyProxy, configFile)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	if watchInterval > 0 {
+		go keyProxy.WatchConfigFile(ctx, configFile, time.Duration(watchInterval)*time.Second)
+	}
+	err = keyProxy.RunContext(ctx)
 	if err != nil {
 		panic(err)
 	}
 }
+
+// reloadOnSignal reloads the config file on SIGHUP.
+func reloadOnSignal(keyProxy *proxy.KeyProxy, configFile string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	ctx := context.Background()
+	for range signals {
+		logs.CtxInfo(ctx, "received SIGHUP, reloading config file %s", configFile)
+		if err := keyProxy.ReloadFromFile(configFile); err != nil {
+			logs.CtxError(ctx, "reload config failed, keep serving with the old config: %v", err)
+		}
+	}
+}
+
+// encrypt encrypts the plain secrets of the config file in place, or re-encrypts all of them with a new master key.
+func encrypt(args []string, rotate bool) error {
+	var configFile, masterKeyFile, newMasterKeyFile string
+	name := "encrypt"
+	if rotate {
+		name = "rotate"
+	}
+	flagSet := flag.NewFlagSet(name, flag.ExitOnError)
+	flagSet.StringVar(&configFile, "conf-file", "./config.yml", "config file path")
+	flagSet.StringVar(&masterKeyFile, "master-key-file", "", "master key file path, defaults to $"+secret.MasterKeyFileEnv+" or $"+secret.MasterKeyEnv)
+	if rotate {
+		flagSet.StringVar(&newMasterKeyFile, "new-master-key-file", "", "new master key file path")
+	}
+	_ = flagSet.Parse(args)
+
+	masterKey, err := secret.LoadMasterKey(masterKeyFile)
+	if err != nil {
+		return err
+	}
+	if masterKey == nil {
+		return errors.New("master key is not configured")
+	}
+	var newMasterKey []byte
+	if rotate {
+		if newMasterKeyFile == "" {
+			return errors.New("-new-master-key-file is required")
+		}
+		data, err := os.ReadFile(newMasterKeyFile)
+		if err != nil {
+			return err
+		}
+		if newMasterKey, err = secret.ParseMasterKey(data); err != nil {
+			return err
+		}
+	}
+	count, err := proxy.EncryptConfigFile(configFile, masterKey, newMasterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d values encrypted in %s\n", count, configFile)
+	return nil
+}
+
+func genMasterKey() error {
+	key, err := secret.GenerateMasterKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+// verifyAudit verifies the hash chain of the audit files with Audit.Key, it fails if any record was modified or
+// deleted, or if the anchored record is missing.
+func verifyAudit(args []string) error {
+	var configFile, anchorFlag string
+	flagSet := flag.NewFlagSet("verify-audit", flag.ExitOnError)
+	flagSet.StringVar(&configFile, "conf-file", "./config.yml", "config file path, whose Audit.Key is used and whose Audit.Output is verified if no files are given")
+	flagSet.StringVar(&anchorFlag, "anchor", "", "seq:hash of an anchor logged or exported by the proxy, which the chain must contain")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s verify-audit [-conf-file config.yml] [-anchor seq:hash] [audit files or directories...]\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+
+	var anchor *audit.Anchor
+	if anchorFlag != "" {
+		parts := strings.SplitN(anchorFlag, ":", 2)
+		seq, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil || len(parts) != 2 || parts[1] == "" {
+			return fmt.Errorf("invalid anchor %q, expected seq:hash", anchorFlag)
+		}
+		anchor = &audit.Anchor{Seq: seq, Hash: parts[1]}
+	}
+	config, err := proxy.LoadYamlConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if config.Audit.Key == "" {
+		return errors.New("Audit.Key is not configured")
+	}
+	key, err := proxy.ResolveAuditKey(context.Background(), config)
+	if err != nil {
+		return err
+	}
+	paths := flagSet.Args()
+	if len(paths) == 0 {
+		dir := config.Audit.Output
+		if dir == "" {
+			dir = audit.DefaultOutput
+		}
+		paths = []string{dir}
+	}
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		dirFiles, err := audit.Files(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, dirFiles...)
+	}
+	if len(files) == 0 {
+		return errors.New("no audit files found")
+	}
+	result, err := audit.Verify(files, key, anchor)
+	if err != nil {
+		return fmt.Errorf("audit verification failed after %d records: %v", result.Records, err)
+	}
+	fmt.Printf("%d records in %d files verified, seq %d to %d\n", result.Records, result.Files, result.FirstSeq, result.LastSeq)
+	if result.FirstSeq > 1 {
+		fmt.Printf("the chain starts after the record with hash %s, older records were rotated out\n", result.FirstPrevHash)
+	}
+	fmt.Printf("last record, which can be verified as the anchor: %d:%s\n", result.LastSeq, result.LastHash)
+	return nil
+}
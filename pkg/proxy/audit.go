@@ -0,0 +1,63 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/export"
+	"github.com/volcengine/key-proxy/internal/secret"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const defaultAuditAnchorInterval = 60
+
+// ResolveAuditKey resolves the key which chains the audit records from the secret sources.
+func ResolveAuditKey(ctx context.Context, conf *common.Config) ([]byte, error) {
+	key, err := secret.NewResolver(conf.Secrets).Resolve(ctx, conf.Audit.Key)
+	if err != nil {
+		return nil, fmt.Errorf("resolve Audit.Key failed: %v", err)
+	}
+	base.AddKnownSecrets(key)
+	return []byte(key), nil
+}
+
+// anchorAudit logs and exports the last audit record periodically, so that the records truncated from the end of
+// the chain can be detected by verify-audit with the anchors.
+func (s *KeyProxy) anchorAudit(ctx context.Context) {
+	if s.auditWriter == nil {
+		return
+	}
+	interval := s.opt.Config.Audit.AnchorInterval
+	if interval <= 0 {
+		interval = defaultAuditAnchorInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// the records written while draining are anchored by Shutdown
+			return
+		case <-ticker.C:
+			s.anchorLastAuditRecord(ctx)
+		}
+	}
+}
+
+func (s *KeyProxy) anchorLastAuditRecord(ctx context.Context) {
+	anchor, ok := s.auditWriter.Anchor()
+	if !ok {
+		return
+	}
+	logs.CtxInfo(ctx, "[Audit] anchor, seq: %d, hash: %s", anchor.Seq, anchor.Hash)
+	s.exporter.Export(export.EventAnchor, anchor)
+}
@@ -0,0 +1,169 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const defaultCertReloadInterval = 60
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certStore keeps the certificates of the https listener, and reloads them when the files change,
+// e.g. renewed by cert-manager.
+type certStore struct {
+	pairs        []common.Certificate
+	certificates atomic.Value // []tls.Certificate
+	modTimes     []time.Time
+}
+
+func newCertStore(tlsConf common.Tls) (*certStore, error) {
+	pairs := make([]common.Certificate, 0, 1+len(tlsConf.Certificates))
+	if tlsConf.CertFile != "" || tlsConf.KeyFile != "" {
+		pairs = append(pairs, common.Certificate{CertFile: tlsConf.CertFile, KeyFile: tlsConf.KeyFile})
+	}
+	pairs = append(pairs, tlsConf.Certificates...)
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificate is configured for https")
+	}
+	store := &certStore{pairs: pairs}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// load loads all the certificates, the current ones are kept if any of them failed to load.
+func (c *certStore) load() error {
+	certificates := make([]tls.Certificate, 0, len(c.pairs))
+	modTimes := make([]time.Time, 0, len(c.pairs))
+	for _, pair := range c.pairs {
+		modTime, err := pairModTime(pair)
+		if err != nil {
+			return err
+		}
+		certificate, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load certificate %s failed: %v", pair.CertFile, err)
+		}
+		certificates = append(certificates, certificate)
+		modTimes = append(modTimes, modTime)
+	}
+	c.certificates.Store(certificates)
+	c.modTimes = modTimes
+	return nil
+}
+
+func (c *certStore) changed() bool {
+	for i, pair := range c.pairs {
+		modTime, err := pairModTime(pair)
+		if err != nil || !modTime.Equal(c.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the certificates when the files change, until the context is done.
+func (c *certStore) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !c.changed() {
+			continue
+		}
+		if err := c.load(); err != nil {
+			logs.CtxError(ctx, "reload certificates failed, keep using the old ones: %v", err)
+			continue
+		}
+		logs.CtxInfo(ctx, "certificates reloaded")
+	}
+}
+
+// GetCertificate selects the certificate by SNI, the first certificate is used if none of them matches.
+func (c *certStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificates := c.certificates.Load().([]tls.Certificate)
+	for i := range certificates {
+		if hello.SupportsCertificate(&certificates[i]) == nil {
+			return &certificates[i], nil
+		}
+	}
+	return &certificates[0], nil
+}
+
+func pairModTime(pair common.Certificate) (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{pair.CertFile, pair.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+	parsed, found := tlsVersions[version]
+	if !found {
+		return 0, fmt.Errorf("unknown tls version: %q, available versions are: [1.0, 1.1, 1.2, 1.3]", version)
+	}
+	return parsed, nil
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	available := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+	suites := make([]uint16, 0, len(names))
+	var unknown []string
+	for _, name := range names {
+		id, found := available[name]
+		if !found {
+			unknown = append(unknown, name)
+			continue
+		}
+		suites = append(suites, id)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown cipher suites: [%s]", strings.Join(unknown, ", "))
+	}
+	return suites, nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/secret"
+	"gopkg.in/yaml.v3"
+)
+
+// EncryptConfigFile encrypts the plain values of the secret fields listed by configSecrets in the config file in place.
+// If newMasterKey is not nil, the encrypted values are re-encrypted with it as well, which rotates the master key.
+// It returns the number of values written.
+func EncryptConfigFile(path string, masterKey, newMasterKey []byte) (int, error) {
+	if !fileExist(path) {
+		return 0, fmt.Errorf("config file is not existed: %v", path)
+	}
+	fileBody, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var root yaml.Node
+	if err = yaml.Unmarshal(fileBody, &root); err != nil {
+		return 0, err
+	}
+	var conf common.Config
+	if err = root.Decode(&conf); err != nil {
+		return 0, err
+	}
+	targets := make(map[string]bool)
+	for _, field := range configSecrets(&conf) {
+		if !field.readable {
+			targets[field.path] = true
+		}
+	}
+	targetKey := masterKey
+	if newMasterKey != nil {
+		targetKey = newMasterKey
+	}
+	count := 0
+	err = walkScalarNodes(&root, "", func(path string, node *yaml.Node) error {
+		if !targets[path] {
+			return nil
+		}
+		value := node.Value
+		if value == "" || strings.HasPrefix(value, "<") {
+			// empty values and placeholders in the sample config
+			return nil
+		}
+		if secret.IsEncrypted(value) {
+			if newMasterKey == nil {
+				return nil
+			}
+			plaintext, err := secret.Decrypt(masterKey, value)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", node.Line, err)
+			}
+			value = plaintext
+		}
+		encrypted, err := secret.Encrypt(targetKey, value)
+		if err != nil {
+			return err
+		}
+		node.Value = encrypted
+		node.Style = yaml.DoubleQuotedStyle
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&root); err != nil {
+		return 0, err
+	}
+	if err = encoder.Close(); err != nil {
+		return 0, err
+	}
+	return count, writeFileAtomic(path, buf.Bytes())
+}
+
+// walkScalarNodes calls fn with every scalar value and its path, which is like the paths of configSecrets.
+func walkScalarNodes(node *yaml.Node, path string, fn func(path string, node *yaml.Node) error) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := walkScalarNodes(child, path, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := walkScalarNodes(child, fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childPath := strings.TrimPrefix(path+"."+node.Content[i].Value, ".")
+			if err := walkScalarNodes(node.Content[i+1], childPath, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		return fn(path, node)
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
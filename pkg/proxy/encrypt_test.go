@@ -0,0 +1,206 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/secret"
+)
+
+const plainConfig = `# the comments are kept
+Admin:
+  Token: admin-token
+Audit:
+  Key: audit-key-0123456789
+Secrets:
+  Vault:
+    Token: vault-token
+Tracing:
+  Endpoint: http://127.0.0.1:4318/v1/traces
+  Headers:
+    Authorization: Bearer tracing-token
+Export:
+  Webhook:
+    - Url: https://siem.example.com/events
+      Secret: webhook-secret
+      Headers:
+        X-Token: webhook-token
+  Kafka:
+    - Topic: events
+      Sasl:
+        Username: key-proxy
+        Password: kafka-password
+Endpoints:
+  - CloudAccountName: acc_a
+    Vendor: volcengine # not a secret
+    Credentials:
+      Proxy:
+        AccessKey: proxy-ak
+        SecretKey: proxy-sk
+      Proxies:
+        - Name: next
+          AccessKey: next-ak
+          SecretKey: next-sk
+      Real:
+        AccessKey: real-ak
+        SecretKey: real-sk
+  - CloudAccountName: acc_b
+    Vendor: akamai
+    Credentials:
+      Real:
+        AccessToken: akamai-access-token
+        ClientToken: akamai-client-token
+        ClientSecret: akamai-client-secret
+        SecretKey: "<Real Secret Key>"
+`
+
+// encryptedValues are the values of plainConfig which are encrypted, the access keys and placeholders are kept.
+var encryptedValues = []string{
+	"admin-token", "audit-key-0123456789", "vault-token", "Bearer tracing-token", "webhook-secret", "webhook-token",
+	"kafka-password", "proxy-sk", "next-sk", "real-sk", "akamai-access-token", "akamai-client-token",
+	"akamai-client-secret",
+}
+
+func newMasterKey(t *testing.T) []byte {
+	encoded, err := secret.GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := secret.ParseMasterKey([]byte(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// loadWithMasterKey loads the config file with the master key in the environment.
+func loadWithMasterKey(t *testing.T, path string, key []byte) (*common.Config, error) {
+	file := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(file, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(secret.MasterKeyFileEnv, file)
+	defer os.Unsetenv(secret.MasterKeyFileEnv)
+	return LoadYamlConfig(path)
+}
+
+func writeConfig(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEncryptConfigFile(t *testing.T) {
+	path := writeConfig(t, plainConfig)
+	key := newMasterKey(t)
+	count, err := EncryptConfigFile(path, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(encryptedValues) {
+		t.Errorf("%d values encrypted, want %d", count, len(encryptedValues))
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range encryptedValues {
+		if strings.Contains(string(body), value) {
+			t.Errorf("%s is not encrypted", value)
+		}
+	}
+	for _, value := range []string{"# the comments are kept", "# not a secret", "proxy-ak", "real-ak", "<Real Secret Key>", "Username: key-proxy"} {
+		if !strings.Contains(string(body), value) {
+			t.Errorf("%s is not kept", value)
+		}
+	}
+	// encrypted values are kept as they are
+	if count, err = EncryptConfigFile(path, key, nil); err != nil || count != 0 {
+		t.Errorf("encrypting again: %d values encrypted, error: %v", count, err)
+	}
+
+	conf, err := loadWithMasterKey(t, path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := loadWithMasterKey(t, writeConfig(t, plainConfig), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]string)
+	for _, field := range configSecrets(plain) {
+		want[field.path] = field.value
+	}
+	for _, field := range configSecrets(conf) {
+		if field.value != want[field.path] {
+			t.Errorf("%s is %q after the round trip, want %q", field.path, field.value, want[field.path])
+		}
+	}
+	if _, err = loadWithMasterKey(t, path, newMasterKey(t)); err == nil {
+		t.Errorf("config is decrypted with another master key")
+	}
+}
+
+func TestRotateConfigFile(t *testing.T) {
+	path := writeConfig(t, plainConfig)
+	oldKey, newKey := newMasterKey(t), newMasterKey(t)
+	if _, err := EncryptConfigFile(path, oldKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	count, err := EncryptConfigFile(path, oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(encryptedValues) {
+		t.Errorf("%d values re-encrypted, want %d", count, len(encryptedValues))
+	}
+	conf, err := loadWithMasterKey(t, path, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Endpoints[0].Credentials.Real.SecretKey != "real-sk" || conf.Tracing.Headers["Authorization"] != "Bearer tracing-token" {
+		t.Errorf("secrets are not decrypted with the new master key")
+	}
+	if _, err = loadWithMasterKey(t, path, oldKey); err == nil {
+		t.Errorf("config is decrypted with the old master key")
+	}
+}
+
+func TestRejectEncryptedUnsupportedFields(t *testing.T) {
+	key := newMasterKey(t)
+	envelope, err := secret.Encrypt(key, "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"Endpoints[0].CloudAccountName": "Endpoints:\n  - CloudAccountName: \"%s\"\n",
+		"Endpoints[0].Vendor":           "Endpoints:\n  - CloudAccountName: acc_a\n    Vendor: \"%s\"\n",
+		"Tracing.Endpoint":              "Tracing:\n  Endpoint: \"%s\"\n",
+		"Export.Kafka[0].Sasl.Username": "Export:\n  Kafka:\n    - Sasl:\n        Username: \"%s\"\n",
+	}
+	for path, body := range cases {
+		_, err := loadWithMasterKey(t, writeConfig(t, strings.Replace(body, "%s", envelope, 1)), key)
+		if err == nil || !strings.Contains(err.Error(), path+" does not support encrypted values") {
+			t.Errorf("%s: error is %v", path, err)
+		}
+	}
+	// the access keys are decrypted although EncryptConfigFile keeps them readable
+	conf, err := loadWithMasterKey(t, writeConfig(t, "Endpoints:\n  - Credentials:\n      Real:\n        AccessKey: \""+envelope+"\"\n"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Endpoints[0].Credentials.Real.AccessKey != "value" {
+		t.Errorf("access key is %q, want %q", conf.Endpoints[0].Credentials.Real.AccessKey, "value")
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/volcengine/key-proxy/internal/config"
+	"github.com/volcengine/key-proxy/internal/service"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const (
+	defaultExpiryWarnBefore     = 14
+	defaultExpiryCheckInterval  = 3600
+	defaultExpiryRemindInterval = 86400
+
+	ProxyCredentialExpiringEvent = "ProxyCredentialExpiring"
+	ProxyCredentialExpiredEvent  = "ProxyCredentialExpired"
+)
+
+var proxyCredentialExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "key_proxy_proxy_credential_expiry_timestamp_seconds",
+	Help: "Unix time when the proxy credential expires.",
+}, []string{"cloud_account", "credential"})
+
+// ExpiryReminder is posted to the webhook when a proxy credential is about to expire or has expired.
+type ExpiryReminder struct {
+	Event            string
+	CloudAccountName string
+	Credential       string
+	NotAfter         time.Time
+	Message          string
+}
+
+// watchCredentialExpiry checks the expiry of the proxy credentials periodically. It exports the expiry as a metric,
+// and reminds to rotate the credentials in logs and through the webhook before they expire.
+func (s *KeyProxy) watchCredentialExpiry(ctx context.Context) {
+	interval := config.Get().Expiry.CheckInterval
+	if interval <= 0 {
+		interval = defaultExpiryCheckInterval
+	}
+	reminded := make(map[string]time.Time)
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		s.checkCredentialExpiry(ctx, reminded)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *KeyProxy) checkCredentialExpiry(ctx context.Context, reminded map[string]time.Time) {
+	conf := config.Get().Expiry
+	warnBefore := conf.WarnBefore
+	if warnBefore <= 0 {
+		warnBefore = defaultExpiryWarnBefore
+	}
+	remindInterval := conf.RemindInterval
+	if remindInterval <= 0 {
+		remindInterval = defaultExpiryRemindInterval
+	}
+
+	now := time.Now()
+	proxyCredentialExpiry.Reset()
+	for _, expiry := range service.GetProviderService().ProxyCredentialExpiries() {
+		proxyCredentialExpiry.WithLabelValues(expiry.CloudAccountName, expiry.Credential).Set(float64(expiry.NotAfter.Unix()))
+		remaining := expiry.NotAfter.Sub(now)
+		if remaining > time.Duration(warnBefore)*24*time.Hour {
+			continue
+		}
+		key := expiry.CloudAccountName + "/" + expiry.Credential
+		if last, found := reminded[key]; found && now.Sub(last) < time.Duration(remindInterval)*time.Second {
+			continue
+		}
+		reminded[key] = now
+
+		reminder := ExpiryReminder{
+			Event:            ProxyCredentialExpiringEvent,
+			CloudAccountName: expiry.CloudAccountName,
+			Credential:       expiry.Credential,
+			NotAfter:         expiry.NotAfter,
+		}
+		if remaining <= 0 {
+			reminder.Event = ProxyCredentialExpiredEvent
+			reminder.Message = fmt.Sprintf("proxy credential %s of cloud account %s expired at %s, requests signed with it are rejected",
+				expiry.Credential, expiry.CloudAccountName, expiry.NotAfter.Format(time.RFC3339))
+			logs.CtxError(ctx, "[Expiry] %s", reminder.Message)
+		} else {
+			reminder.Message = fmt.Sprintf("proxy credential %s of cloud account %s expires at %s in %.1f days, please rotate it",
+				expiry.Credential, expiry.CloudAccountName, expiry.NotAfter.Format(time.RFC3339), remaining.Hours()/24)
+			logs.CtxWarn(ctx, "[Expiry] %s", reminder.Message)
+		}
+		if conf.Webhook != "" {
+			if err := postExpiryReminder(ctx, conf.Webhook, reminder); err != nil {
+				logs.CtxWarn(ctx, "[Expiry] post reminder to the webhook failed: %v", err)
+			}
+		}
+	}
+}
+
+func postExpiryReminder(ctx context.Context, webhook string, reminder ExpiryReminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
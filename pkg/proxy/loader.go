@@ -9,8 +9,11 @@ package proxy
 import (
 	"fmt"
 	"github.com/volcengine/key-proxy/common"
-	"gopkg.in/yaml.v2"
+	"github.com/volcengine/key-proxy/internal/secret"
+	"gopkg.in/yaml.v3"
 	"os"
+	"reflect"
+	"strings"
 )
 
 func LoadYamlConfig(configFilePath string) (*common.Config, error) {
@@ -18,9 +21,145 @@ func LoadYamlConfig(configFilePath string) (*common.Config, error) {
 	if err := unmarshalConfDir(configFilePath, &conf); err != nil {
 		return nil, fmt.Errorf("read config failed: %v", err)
 	}
+	if err := decryptConfig(&conf); err != nil {
+		return nil, fmt.Errorf("decrypt config failed: %v", err)
+	}
 	return &conf, nil
 }
 
+// secretField is a config field which holds a secret and may be encrypted. It is the only list of such fields, which
+// both EncryptConfigFile and decryptConfig follow.
+type secretField struct {
+	path     string // keys of the YAML document, like "Endpoints[0].Credentials.Real.SecretKey"
+	value    string
+	set      func(value string)
+	readable bool // kept in plain text by EncryptConfigFile, like the access keys
+}
+
+func stringField(path string, value *string, readable bool) secretField {
+	return secretField{path: path, value: *value, set: func(v string) { *value = v }, readable: readable}
+}
+
+// credentialSecrets returns the fields of the credential which may be encrypted, access keys are kept readable.
+func credentialSecrets(path string, cre *common.Credential) []secretField {
+	return []secretField{
+		stringField(path+".AccessKey", &cre.AccessKey, true),
+		stringField(path+".SecretKey", &cre.SecretKey, false),
+		stringField(path+".AccessToken", &cre.AccessToken, false),
+		stringField(path+".ClientToken", &cre.ClientToken, false),
+		stringField(path+".ClientSecret", &cre.ClientSecret, false),
+	}
+}
+
+// headerSecrets returns the values of the headers, which may carry the auth tokens.
+func headerSecrets(path string, headers map[string]string) []secretField {
+	fields := make([]secretField, 0, len(headers))
+	for name, value := range headers {
+		name := name
+		fields = append(fields, secretField{path: path + "." + name, value: value, set: func(v string) { headers[name] = v }})
+	}
+	return fields
+}
+
+// configSecrets returns the fields of the config which hold secrets and may be encrypted.
+func configSecrets(conf *common.Config) []secretField {
+	fields := []secretField{
+		stringField("Secrets.Vault.Token", &conf.Secrets.Vault.Token, false),
+		stringField("Admin.Token", &conf.Admin.Token, false),
+		stringField("Audit.Key", &conf.Audit.Key, false),
+	}
+	fields = append(fields, headerSecrets("Tracing.Headers", conf.Tracing.Headers)...)
+	for i := range conf.Endpoints {
+		credentials := &conf.Endpoints[i].Credentials
+		path := fmt.Sprintf("Endpoints[%d].Credentials", i)
+		fields = append(fields, credentialSecrets(path+".Proxy", &credentials.Proxy)...)
+		fields = append(fields, credentialSecrets(path+".Real", &credentials.Real)...)
+		for j := range credentials.Proxies {
+			fields = append(fields, credentialSecrets(fmt.Sprintf("%s.Proxies[%d]", path, j), &credentials.Proxies[j].Credential)...)
+		}
+	}
+	for i := range conf.Export.Webhook {
+		webhook := &conf.Export.Webhook[i]
+		fields = append(fields, stringField(fmt.Sprintf("Export.Webhook[%d].Secret", i), &webhook.Secret, false))
+		fields = append(fields, headerSecrets(fmt.Sprintf("Export.Webhook[%d].Headers", i), webhook.Headers)...)
+	}
+	for i := range conf.Export.Kafka {
+		fields = append(fields, stringField(fmt.Sprintf("Export.Kafka[%d].Sasl.Password", i), &conf.Export.Kafka[i].Sasl.Password, false))
+	}
+	return fields
+}
+
+// decryptConfig decrypts the "enc:v1:" values of the secret fields with the master key from the environment. The
+// other fields do not support encrypted values, which are rejected instead of being used as they are.
+func decryptConfig(conf *common.Config) error {
+	var masterKey []byte
+	decrypt := func(path, value string) (string, error) {
+		if !secret.IsEncrypted(value) {
+			return value, nil
+		}
+		if masterKey == nil {
+			key, err := secret.LoadMasterKey("")
+			if err != nil {
+				return "", err
+			}
+			if key == nil {
+				return "", fmt.Errorf("encrypted values found but neither %s nor %s is set", secret.MasterKeyEnv, secret.MasterKeyFileEnv)
+			}
+			masterKey = key
+		}
+		plaintext, err := secret.Decrypt(masterKey, value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", path, err)
+		}
+		return plaintext, nil
+	}
+	for _, field := range configSecrets(conf) {
+		plaintext, err := decrypt(field.path, field.value)
+		if err != nil {
+			return err
+		}
+		field.set(plaintext)
+	}
+	if path := findEncrypted(reflect.ValueOf(conf).Elem(), ""); path != "" {
+		return fmt.Errorf("%s does not support encrypted values", path)
+	}
+	return nil
+}
+
+// findEncrypted returns the path of the first string which is still encrypted.
+func findEncrypted(v reflect.Value, path string) string {
+	switch v.Kind() {
+	case reflect.String:
+		if secret.IsEncrypted(v.String()) {
+			return path
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return findEncrypted(v.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if found := findEncrypted(v.Field(i), strings.TrimPrefix(path+"."+v.Type().Field(i).Name, ".")); found != "" {
+				return found
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if found := findEncrypted(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); found != "" {
+				return found
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if found := findEncrypted(iter.Value(), fmt.Sprintf("%s.%v", path, iter.Key())); found != "" {
+				return found
+			}
+		}
+	}
+	return ""
+}
+
 func fileExist(path string) bool {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return false
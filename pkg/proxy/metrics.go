@@ -0,0 +1,48 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/metrics"
+)
+
+var (
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "key_proxy_upstream_duration_seconds",
+		Help:    "Latency of the requests to the cloud vendors, till the response headers are received.",
+		Buckets: metrics.DurationBuckets,
+	}, []string{"vendor", "cloud_account", "status"})
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "key_proxy_upstream_errors_total",
+		Help: "Network errors of the requests to the cloud vendors, reported as NetworkErr.",
+	}, []string{"vendor", "cloud_account"})
+)
+
+// metricsTransport records the latency of the requests to the cloud vendors, and the status they responded.
+type metricsTransport struct {
+	http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	vendor, cloudAccount := base.MetricLabels(req.Context(), base.GetRequestState(req.Context()).BaseInfo.CloudAccountName)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+		base.GetRequestState(req.Context()).SetUpstreamStatus(resp.StatusCode)
+	}
+	upstreamDuration.WithLabelValues(vendor, cloudAccount, status).Observe(time.Since(start).Seconds())
+	return resp, err
+}
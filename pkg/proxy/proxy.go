@@ -8,16 +8,30 @@ package proxy
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/admin"
+	"github.com/volcengine/key-proxy/internal/audit"
 	"github.com/volcengine/key-proxy/internal/base"
 	"github.com/volcengine/key-proxy/internal/config"
+	"github.com/volcengine/key-proxy/internal/export"
 	"github.com/volcengine/key-proxy/internal/handler"
 	"github.com/volcengine/key-proxy/internal/middleware"
+	"github.com/volcengine/key-proxy/internal/secret"
 	"github.com/volcengine/key-proxy/internal/service"
+	"github.com/volcengine/key-proxy/internal/service/provider"
+	"github.com/volcengine/key-proxy/internal/tracing"
 	"github.com/volcengine/key-proxy/internal/utils/logs"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var (
@@ -30,6 +44,8 @@ type Option struct {
 	OnRequestHook         common.OnRequest
 	OnReformedRequestHook common.OnRequest
 	OnResponseHook        common.OnResponse
+	OnShutdownHooks       []common.OnShutdown
+	ConfigFile            string // reloaded by the admin API
 }
 
 type withOption func(o *Option)
@@ -46,14 +62,56 @@ func WithOnRequestHook(hook common.OnRequest) withOption {
 	}
 }
 
+// WithOnReformedRequestHook sets a hook called after the request is validated and resigned, before it is forwarded.
+func WithOnReformedRequestHook(hook common.OnRequest) withOption {
+	return func(o *Option) {
+		o.OnReformedRequestHook = hook
+	}
+}
+
 func WithOnResponseHook(hook common.OnResponse) withOption {
 	return func(o *Option) {
 		o.OnResponseHook = hook
 	}
 }
 
+// WithOnShutdownHook adds a hook called while shutting down, after the in-flight requests are drained.
+// It can be used to flush custom loggers and audit sinks.
+func WithOnShutdownHook(hook common.OnShutdown) withOption {
+	return func(o *Option) {
+		o.OnShutdownHooks = append(o.OnShutdownHooks, hook)
+	}
+}
+
+// WithConfigFile sets the config file which the admin API reloads the proxy from.
+func WithConfigFile(path string) withOption {
+	return func(o *Option) {
+		o.ConfigFile = path
+	}
+}
+
+const (
+	defaultShutdownTimeout   = 30
+	roleSessionCheckInterval = 30 * time.Second
+	defaultMetricsPath       = "/metrics"
+)
+
 type KeyProxy struct {
-	opt Option
+	opt         Option
+	reloadMu    sync.Mutex
+	auditWriter *audit.Writer    // nil if auditing is disabled
+	exporter    *export.Exporter // nil if no export sink is configured
+	listening   int32            // 1 once all the listeners are up
+	recorder    *admin.Recorder  // nil if the admin API is disabled
+	adminToken  string
+
+	// ctx is canceled when shutting down, it stops the background goroutines
+	ctx          context.Context
+	cancel       context.CancelFunc
+	mu           sync.Mutex
+	servers      []*http.Server
+	shutdownOnce sync.Once
+	shutdownErr  error
 }
 
 func New(conf *common.Config, opts ...withOption) (*KeyProxy, error) {
@@ -62,82 +120,319 @@ func New(conf *common.Config, opts ...withOption) (*KeyProxy, error) {
 		opt(&option)
 	}
 	if option.Logger == nil {
-		standardLogger, err := logs.NewStandardLogger()
+		// the config has not been stored yet, so the Log config is passed in
+		standardLogger, err := logs.NewStandardLogger(conf.Log)
 		if err != nil {
 			return nil, err
 		}
 		option.Logger = standardLogger
 	}
+	// the custom hooks get the redacted copies of the requests, the standard ones redact what they dump
 	if option.OnRequestHook == nil {
 		option.OnRequestHook = middleware.StandardOnRequest
+	} else {
+		option.OnRequestHook = base.RedactOnRequest(option.OnRequestHook)
 	}
 	if option.OnResponseHook == nil {
 		option.OnResponseHook = middleware.StandardOnResponse
+	} else {
+		option.OnResponseHook = base.RedactOnResponse(option.OnResponseHook)
+	}
+	if option.OnReformedRequestHook != nil {
+		option.OnReformedRequestHook = base.RedactOnRequest(option.OnReformedRequestHook)
 	}
 	logs.MustInit(option.Logger)
+	tracing.Init(conf.Tracing)
 	s := &KeyProxy{
 		opt: option,
 	}
-	err := s.Reload(s.opt.Config)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if conf.Audit.Enabled {
+		key, err := ResolveAuditKey(s.ctx, conf)
+		if err != nil {
+			return nil, err
+		}
+		auditWriter, err := audit.NewWriter(conf.Audit, key)
+		if err != nil {
+			return nil, fmt.Errorf("open audit file failed: %v", err)
+		}
+		s.auditWriter = auditWriter
+	}
+	exporter, err := export.New(conf.Export)
+	if err != nil {
+		return nil, fmt.Errorf("create export sinks failed: %v", err)
+	}
+	s.exporter = exporter
+	if conf.Admin.Enabled {
+		if err := s.initAdmin(conf); err != nil {
+			return nil, fmt.Errorf("init admin failed: %v", err)
+		}
+	}
+	err = s.reload(s.opt.Config)
 	return s, err
 }
 
 func (s *KeyProxy) Run() error {
-	return s.RegisterHttp()
+	return s.RunContext(context.Background())
+}
+
+// RunContext serves until the context is done or any listener fails, then stops accepting new connections and
+// drains the in-flight requests for at most Http.ShutdownTimeout seconds. The audit file, the export spool and the
+// tracing queue are flushed on both paths.
+func (s *KeyProxy) RunContext(ctx context.Context) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer func() {
+		timeout := s.opt.Config.Http.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
+		}
+		logs.CtxInfo(context.Background(), "shutting down, draining in-flight requests for at most %ds", timeout)
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+		defer shutdownCancel()
+		// the error of serving takes precedence over the error of shutting down
+		if shutdownErr := s.Shutdown(shutdownCtx); err == nil {
+			err = shutdownErr
+		}
+	}()
+	go s.refreshSecrets(ctx)
+	go s.refreshRoleSessions(ctx)
+	go s.watchCredentialExpiry(ctx)
+	go s.anchorAudit(ctx)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.RegisterHttp()
+	}()
+	select {
+	case err = <-errCh:
+		if err != nil {
+			logs.CtxError(context.Background(), "serve failed: %v", err)
+		}
+	case <-ctx.Done():
+	}
+	return err
 }
 
+// Shutdown stops the servers gracefully, waits for the in-flight requests until the context is done,
+// then calls the shutdown hooks and flushes the logger. It is safe to call Shutdown more than once.
+func (s *KeyProxy) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.cancel()
+		s.mu.Lock()
+		servers := s.servers
+		s.mu.Unlock()
+		// the servers are shut down concurrently, so that none of them keeps accepting requests while another drains
+		shutdownErrs := make([]error, len(servers))
+		var wg sync.WaitGroup
+		for i, server := range servers {
+			wg.Add(1)
+			go func(i int, server *http.Server) {
+				defer wg.Done()
+				shutdownErrs[i] = server.Shutdown(ctx)
+			}(i, server)
+		}
+		wg.Wait()
+		var errs []string
+		for i, err := range shutdownErrs {
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("shutdown server %s failed: %v", servers[i].Addr, err))
+			}
+		}
+		for _, hook := range s.opt.OnShutdownHooks {
+			if err := hook(ctx); err != nil {
+				errs = append(errs, fmt.Sprintf("shutdown hook failed: %v", err))
+			}
+		}
+		if s.auditWriter != nil {
+			s.anchorLastAuditRecord(ctx)
+		}
+		if err := s.exporter.Close(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("close exporter failed: %v", err))
+		}
+		if s.auditWriter != nil {
+			if err := s.auditWriter.Close(); err != nil {
+				errs = append(errs, fmt.Sprintf("close audit file failed: %v", err))
+			}
+		}
+		if err := tracing.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("shutdown tracing failed: %v", err))
+		}
+		if len(errs) > 0 {
+			s.shutdownErr = errors.New(strings.Join(errs, "; "))
+			logs.CtxError(ctx, "%v", s.shutdownErr)
+		} else {
+			logs.CtxInfo(ctx, "shutdown completed")
+		}
+		_ = logs.Sync()
+	})
+	return s.shutdownErr
+}
+
+// refreshSecrets resolves the credentials from the secret sources periodically, so that rotated secrets are
+// picked up without editing the config.
+func (s *KeyProxy) refreshSecrets(ctx context.Context) {
+	interval := s.opt.Config.Secrets.RefreshInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := service.GetProviderService().RefreshSecrets(ctx); err != nil {
+			logs.CtxWarn(ctx, "refresh secrets failed: %v", err)
+		}
+	}
+}
+
+// refreshRoleSessions refreshes the temporary credentials of the assumed roles before they expire.
+func (s *KeyProxy) refreshRoleSessions(ctx context.Context) {
+	ticker := time.NewTicker(roleSessionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := service.GetProviderService().RefreshRoleSessions(ctx); err != nil {
+			logs.CtxWarn(ctx, "refresh temporary credentials failed: %v", err)
+		}
+	}
+}
+
+// Reload validates the config and builds the providers, then replaces the running ones with them.
+// The running config is kept if any error occurred.
 func (s *KeyProxy) Reload(conf *common.Config) error {
-	err := service.Init(conf)
-	if err != nil {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	oldConf := config.Get()
+	if err := s.reload(conf); err != nil {
 		return err
 	}
-	config.MustInit(conf)
+	logConfigDiff(context.Background(), oldConf, conf)
 	return nil
 }
 
+func (s *KeyProxy) reload(conf *common.Config) error {
+	return service.Init(conf)
+}
+
 func (s *KeyProxy) RegisterHttp() error {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 
 	r.Use(middleware.SetMcdnArgs())
-	r.Use(middleware.TrafficLogger(s.opt.OnRequestHook, s.opt.OnResponseHook))
+	r.Use(middleware.Metrics())
+	if s.recorder != nil {
+		r.Use(middleware.Stats(s.recorder))
+	}
+	if s.auditWriter != nil {
+		r.Use(middleware.Audit(s.auditWriter, s.exporter))
+	}
+	r.Use(middleware.TrafficLogger(s.opt.OnRequestHook, s.opt.OnResponseHook, s.exporter))
 	r.Use(middleware.ExceptionGuard(s.opt.OnResponseHook))
+	// the probes are called by the load balancers and the orchestrators rather than the clients, so they are
+	// registered before the guards of the clients
+	readiness := handler.NewReadiness(s.listeningErr)
+	r.GET("/healthz", handler.Healthz)
+	r.GET("/readyz", readiness.Readyz)
+	r.GET("/selftest", readiness.SelfTest)
+	r.Use(middleware.ClientIPGuard())
+	r.Use(middleware.ClientCertBinding())
 	s.customizeRegister(r)
 
-	var err error
-	httpConf := s.opt.Config.Http
-	tlsConf := httpConf.Tls
+	var adminHandler http.Handler
+	if s.recorder != nil {
+		adminHandler = admin.NewHandler(s.recorder, s.adminToken, s.reloadConfigFile, readiness)
+	}
+	return s.serve(r, adminHandler)
+}
 
-	ctx := context.Background()
-	if tlsConf.Enabled {
-		logs.CtxInfo(ctx, "launch https server on %v", tlsConf.Address)
-		if err = r.RunTLS(tlsConf.Address, tlsConf.CertFile, tlsConf.KeyFile); err != nil {
-			return err
+// initAdmin resolves the token of the admin API and creates the recorder of the requests. The admin API is refused
+// unless the clients are authenticated by the token or the client certificates.
+func (s *KeyProxy) initAdmin(conf *common.Config) error {
+	adminConf := conf.Admin
+	mTLS := adminConf.Tls.Enabled && adminConf.Tls.ClientAuth.Mode == "require"
+	if adminConf.Token == "" && !mTLS {
+		return errors.New("either Token or Tls with ClientAuth.Mode require must be configured")
+	}
+	if adminConf.Token != "" {
+		token, err := secret.NewResolver(conf.Secrets).Resolve(s.ctx, adminConf.Token)
+		if err != nil {
+			return fmt.Errorf("resolve token failed: %v", err)
 		}
-	} else {
-		logs.CtxInfo(ctx, "launch http server on %v", httpConf.Address)
-		if err = r.Run(httpConf.Address); err != nil {
-			return err
+		if token == "" {
+			return errors.New("token is empty")
 		}
+		base.AddKnownSecrets(token)
+		s.adminToken = token
 	}
+	s.recorder = admin.NewRecorder(adminConf.MaxBlocked)
 	return nil
 }
 
+func (s *KeyProxy) reloadConfigFile() error {
+	if s.opt.ConfigFile == "" {
+		return errors.New("config file is unknown, it must be set with WithConfigFile")
+	}
+	return s.ReloadFromFile(s.opt.ConfigFile)
+}
+
 func (s *KeyProxy) customizeRegister(r *gin.Engine) {
 	r.GET("/ping", handler.Ping)
+	if metricsConf := s.opt.Config.Metrics; metricsConf.Enabled == nil || *metricsConf.Enabled {
+		path := metricsConf.Path
+		if path == "" {
+			path = defaultMetricsPath
+		}
+		r.GET(path, gin.WrapH(promhttp.Handler()))
+	}
 	{
 		p := new(httputil.ReverseProxy)
 		defaultTransport.MaxIdleConns = 200
 		defaultTransport.MaxConnsPerHost = 100
 		defaultTransport.MaxIdleConnsPerHost = 100
-		p.Transport = defaultTransport
+		// the upstream is always dialed directly, a proxy from the environment would bypass the dial guard
+		defaultTransport.Proxy = nil
+		defaultTransport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialer := &net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}
+			if !config.FromContext(ctx).Config.Upstream.AllowPrivateNetwork {
+				dialer.Control = guardUpstreamAddress
+			}
+			return dialer.DialContext(ctx, network, address)
+		}
+		p.Transport = tracingTransport{metricsTransport{defaultTransport}}
 		p.Director = func(req *http.Request) {
-			providerService := service.GetProviderService()
+			providerService := service.ProviderServiceFromContext(req.Context())
 			providerService.ReformRequest(req.Context(), req)
 			logs.CtxInfo(req.Context(), "reformed request: %s", base.DumpHttpRequest(req))
+			if s.opt.OnReformedRequestHook != nil {
+				state := base.GetRequestState(req.Context())
+				baseInfo := state.BaseInfo
+				baseInfo.Request = req
+				s.opt.OnReformedRequestHook(req.Context(), common.RequestInfo{
+					BaseInfo:        baseInfo,
+					RequestTime:     baseInfo.RequestTime,
+					ProxyCredential: state.ProxyCredential(),
+				})
+			}
 		}
 		p.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
 			if err != nil {
+				var exception base.Exception
+				if errors.As(err, &exception) {
+					panic(exception)
+				}
+				upstreamErrors.WithLabelValues(base.MetricLabels(request.Context(), base.GetRequestState(request.Context()).BaseInfo.CloudAccountName)).Inc()
 				panic(base.NetworkErr.WithRawError(err))
 			}
 		}
@@ -146,3 +441,16 @@ func (s *KeyProxy) customizeRegister(r *gin.Engine) {
 		})
 	}
 }
+
+// guardUpstreamAddress refuses to connect to internal addresses, it protects from DNS rebinding
+// after the target host has been checked in ReformRequest.
+func guardUpstreamAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil && provider.IsForbiddenIP(ip) {
+		return base.UpstreamHostForbidden.WithRawError(fmt.Errorf("connecting to internal address %s is forbidden", address))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+// ReloadFromFile loads the config file and reloads the proxy with it.
+func (s *KeyProxy) ReloadFromFile(configFilePath string) error {
+	conf, err := LoadYamlConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	return s.Reload(conf)
+}
+
+// WatchConfigFile checks the config file every interval, and reloads the proxy when its content changes.
+// It returns when the context is done.
+func (s *KeyProxy) WatchConfigFile(ctx context.Context, configFilePath string, interval time.Duration) {
+	lastSum, _ := fileChecksum(configFilePath)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sum, err := fileChecksum(configFilePath)
+		if err != nil || bytes.Equal(sum, lastSum) {
+			continue
+		}
+		lastSum = sum
+		logs.CtxInfo(ctx, "config file %s changed, reloading", configFilePath)
+		if err = s.ReloadFromFile(configFilePath); err != nil {
+			logs.CtxError(ctx, "reload config failed, keep serving with the old config: %v", err)
+		}
+	}
+}
+
+func fileChecksum(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// logConfigDiff logs the cloud accounts added, removed and updated by reloading.
+func logConfigDiff(ctx context.Context, oldConf, newConf *common.Config) {
+	oldEndpoints := make(map[string]common.Endpoint, len(oldConf.Endpoints))
+	for _, endpoint := range oldConf.Endpoints {
+		oldEndpoints[endpoint.CloudAccountName] = endpoint
+	}
+	var added, removed, updated []string
+	for _, endpoint := range newConf.Endpoints {
+		oldEndpoint, existed := oldEndpoints[endpoint.CloudAccountName]
+		delete(oldEndpoints, endpoint.CloudAccountName)
+		if !existed {
+			added = append(added, endpoint.CloudAccountName)
+		} else if !reflect.DeepEqual(oldEndpoint, endpoint) {
+			updated = append(updated, endpoint.CloudAccountName)
+		}
+	}
+	for name := range oldEndpoints {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	logs.CtxInfo(ctx, "config reloaded, added cloud accounts: %v, removed cloud accounts: %v, updated cloud accounts: %v", added, removed, updated)
+	if !reflect.DeepEqual(oldConf.Http, newConf.Http) || !reflect.DeepEqual(oldConf.Log, newConf.Log) ||
+		!reflect.DeepEqual(oldConf.Metrics, newConf.Metrics) || !reflect.DeepEqual(oldConf.Tracing, newConf.Tracing) ||
+		oldConf.Audit != newConf.Audit || !reflect.DeepEqual(oldConf.Export, newConf.Export) ||
+		!reflect.DeepEqual(oldConf.Admin, newConf.Admin) {
+		logs.CtxWarn(ctx, "changes of Http, Log, Metrics, Tracing, Audit, Export and Admin config take effect after restarting")
+	}
+}
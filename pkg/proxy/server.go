@@ -0,0 +1,279 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/volcengine/key-proxy/common"
+	"github.com/volcengine/key-proxy/internal/base"
+	"github.com/volcengine/key-proxy/internal/utils/logs"
+)
+
+const (
+	defaultUnixSocketMode = 0660
+	defaultAdminAddress   = "127.0.0.1:3889"
+)
+
+// serve runs the enabled http, https and unix socket listeners with the same handler concurrently, and the admin
+// listener with adminHandler if it is not nil. It returns when all of them are closed, or closes the others once
+// any of them fails.
+func (s *KeyProxy) serve(handler, adminHandler http.Handler) error {
+	httpConf := s.opt.Config.Http
+	tlsConf := httpConf.Tls
+	unixConf := httpConf.Unix
+	ctx := context.Background()
+
+	// plain http is enabled by default unless https is enabled, which is the behavior before listeners
+	// could be combined
+	httpEnabled := !tlsConf.Enabled
+	if httpConf.Enabled != nil {
+		httpEnabled = *httpConf.Enabled
+	}
+
+	// requests from the listeners without client certificates would be rejected by the bindings
+	if len(tlsConf.ClientAuth.Bindings) > 0 && (httpEnabled || unixConf.Enabled) {
+		return errors.New("client certificate bindings require both plain http and unix socket listeners to be disabled")
+	}
+
+	errCh := make(chan error, 4)
+	running := 0
+	run := func(serveFunc func() error) {
+		running++
+		go func() {
+			err := serveFunc()
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			errCh <- err
+		}()
+	}
+	// listeners are bound before serving, so that /readyz turns ready only after all of them are up
+	if httpEnabled {
+		listener, err := net.Listen("tcp", httpConf.Address)
+		if err != nil {
+			s.closeServers()
+			return err
+		}
+		server := s.newServer(httpConf.Address, handler)
+		logs.CtxInfo(ctx, "launch http server on %v", httpConf.Address)
+		run(func() error {
+			return server.Serve(listener)
+		})
+	}
+	if tlsConf.Enabled {
+		server := s.newServer(tlsConf.Address, handler)
+		tlsConfig, err := s.serverTLSConfig(tlsConf)
+		if err != nil {
+			s.closeServers()
+			return err
+		}
+		server.TLSConfig = tlsConfig
+		listener, err := net.Listen("tcp", tlsConf.Address)
+		if err != nil {
+			s.closeServers()
+			return err
+		}
+		logs.CtxInfo(ctx, "launch https server on %v, client auth: %v", tlsConf.Address, tlsConfig.ClientAuth)
+		run(func() error {
+			// certificates are provided by the GetCertificate of the tls config
+			return server.ServeTLS(listener, "", "")
+		})
+	}
+	if unixConf.Enabled {
+		listener, err := listenUnix(unixConf.Path, unixConf.Mode)
+		if err != nil {
+			s.closeServers()
+			return err
+		}
+		server := s.newServer(unixConf.Path, handler)
+		server.ConnContext = func(ctx context.Context, _ net.Conn) context.Context {
+			return base.WithUnixSocket(ctx)
+		}
+		logs.CtxInfo(ctx, "launch http server on unix socket %v", unixConf.Path)
+		run(func() error {
+			return server.Serve(listener)
+		})
+	}
+	if running == 0 {
+		return errors.New("no listener is enabled, enable at least one of http, https and unix socket")
+	}
+	if adminHandler != nil {
+		adminConf := s.opt.Config.Admin
+		address := adminConf.Address
+		if address == "" {
+			address = defaultAdminAddress
+		}
+		server := s.newServer(address, adminHandler)
+		if adminConf.Tls.Enabled {
+			tlsConfig, err := s.serverTLSConfig(adminConf.Tls)
+			if err != nil {
+				s.closeServers()
+				return fmt.Errorf("admin: %v", err)
+			}
+			server.TLSConfig = tlsConfig
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			s.closeServers()
+			return fmt.Errorf("admin: %v", err)
+		}
+		if server.TLSConfig != nil {
+			logs.CtxInfo(ctx, "launch admin https server on %v, client auth: %v", address, server.TLSConfig.ClientAuth)
+			run(func() error {
+				return server.ServeTLS(listener, "", "")
+			})
+		} else {
+			logs.CtxInfo(ctx, "launch admin http server on %v", address)
+			run(func() error {
+				return server.Serve(listener)
+			})
+		}
+	}
+	atomic.StoreInt32(&s.listening, 1)
+	defer atomic.StoreInt32(&s.listening, 0)
+
+	for i := 0; i < running; i++ {
+		if err := <-errCh; err != nil {
+			s.closeServers()
+			return err
+		}
+	}
+	return nil
+}
+
+// serverTLSConfig builds the tls config whose certificates are reloaded from the files until the proxy shuts down.
+func (s *KeyProxy) serverTLSConfig(tlsConf common.Tls) (*tls.Config, error) {
+	tlsConfig, err := newTLSConfig(tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	store, err := newCertStore(tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.GetCertificate = store.GetCertificate
+	reloadInterval := tlsConf.ReloadInterval
+	if reloadInterval <= 0 {
+		reloadInterval = defaultCertReloadInterval
+	}
+	go store.watch(s.ctx, time.Duration(reloadInterval)*time.Second)
+	return tlsConfig, nil
+}
+
+// newTLSConfig builds the tls config with the protocol versions, cipher suites and client certificate verification.
+func newTLSConfig(tlsConf common.Tls) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(tlsConf.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(tlsConf.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+	}
+	clientAuth := tlsConf.ClientAuth
+	switch clientAuth.Mode {
+	case "", "none":
+		if len(clientAuth.Bindings) > 0 {
+			return nil, errors.New("client certificate bindings require the client auth mode to be optional or require")
+		}
+		return tlsConfig, nil
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode: %q, available modes are: [none, optional, require]", clientAuth.Mode)
+	}
+	caBundle, err := os.ReadFile(clientAuth.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA file failed: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, fmt.Errorf("no certificate found in client CA file %s", clientAuth.CAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	return tlsConfig, nil
+}
+
+// listeningErr returns an error unless all the listeners are up and the proxy is not shutting down.
+func (s *KeyProxy) listeningErr() error {
+	if s.ctx.Err() != nil {
+		return errors.New("shutting down")
+	}
+	if atomic.LoadInt32(&s.listening) == 0 {
+		return errors.New("listeners are not up")
+	}
+	return nil
+}
+
+// newServer creates a server and keeps it, so that it can be shut down gracefully.
+func (s *KeyProxy) newServer(address string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:    address,
+		Handler: handler,
+	}
+	s.mu.Lock()
+	s.servers = append(s.servers, server)
+	s.mu.Unlock()
+	return server
+}
+
+func (s *KeyProxy) closeServers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, server := range s.servers {
+		_ = server.Close()
+	}
+}
+
+// listenUnix listens on the unix domain socket, the stale socket file left by the last run is removed.
+func listenUnix(path, mode string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("the path of unix socket cannot be empty")
+	}
+	fileMode := os.FileMode(defaultUnixSocketMode)
+	if mode != "" {
+		parsed, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unix socket mode %q: %v", mode, err)
+		}
+		fileMode = os.FileMode(parsed)
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a unix socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, fileMode); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
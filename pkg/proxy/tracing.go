@@ -0,0 +1,36 @@
+/*
+Copyright (2023) Beijing Volcano Engine Technology Ltd. All rights reserved.
+
+Use of this source code is governed by the license that can be found in the LICENSE file.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/volcengine/key-proxy/internal/tracing"
+)
+
+// tracingTransport traces the requests to the cloud vendors. The traceparent of the proxy is not sent to the
+// vendors, since the headers of the resigned requests must not be changed.
+type tracingTransport struct {
+	http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, span := tracing.Start(req.Context(), "upstream "+req.Method, tracing.SpanKindClient)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Host)
+	resp, err := t.RoundTripper.RoundTrip(req)
+	span.SetError(err)
+	if err == nil {
+		span.SetIntAttribute("http.response.status_code", resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("upstream responded %s", resp.Status))
+		}
+	}
+	span.End()
+	return resp, err
+}